@@ -1,9 +1,28 @@
 package apollo
 
+import (
+	"context"
+	"sync"
+)
+
 var (
-	defaultClient *Client
+	defaultClient struct {
+		lock   sync.RWMutex
+		client *Client
+		// start serialize starting the default client
+		start sync.Mutex
+	}
 )
 
+// getDefaultClient return client started by package level Start functions, or
+// nil if not started
+func getDefaultClient() *Client {
+	defaultClient.lock.RLock()
+	defer defaultClient.lock.RUnlock()
+
+	return defaultClient.client
+}
+
 // Start apollo
 func Start() error {
 	return StartWithConfFile(defaultConfName)
@@ -18,31 +37,81 @@ func StartWithConfFile(name string) error {
 	return StartWithConf(conf)
 }
 
-// StartWithConf run apollo with Conf
+// StartWithConf run apollo with Conf, ErrAlreadyStarted is returned if the
+// default client is running, Stop it before starting with another Conf
 func StartWithConf(conf *Conf) error {
-	defaultClient = NewClient(conf)
+	defaultClient.start.Lock()
+	defer defaultClient.start.Unlock()
+
+	if client := getDefaultClient(); client != nil && client.isRunning() {
+		return ErrAlreadyStarted
+	}
 
-	return defaultClient.Start()
+	client := NewClient(conf)
+	if err := client.Start(); err != nil {
+		return err
+	}
+
+	defaultClient.lock.Lock()
+	defaultClient.client = client
+	defaultClient.lock.Unlock()
+	return nil
 }
 
-// Stop sync config
-func Stop() error {
-	return defaultClient.Stop()
+// Stop sync config, see Client.Stop
+func Stop(ctx context.Context) error {
+	client := getDefaultClient()
+	if client == nil {
+		return ErrNotStarted
+	}
+	return client.Stop(ctx)
 }
 
-// WatchUpdate get all updates
+// WatchUpdate get all updates, the channel is closed if apollo not started
 func WatchUpdate() <-chan *ChangeEvent {
-	return defaultClient.WatchUpdate()
+	client := getDefaultClient()
+	if client == nil {
+		ch := make(chan *ChangeEvent)
+		close(ch)
+		return ch
+	}
+	return client.WatchUpdate()
+}
+
+// Subscribe to changes of all namespaces
+func Subscribe(opts ...SubscribeOption) (*Subscription, error) {
+	client := getDefaultClient()
+	if client == nil {
+		return nil, ErrNotStarted
+	}
+	return client.Subscribe(opts...), nil
 }
 
 // SubscribeToNamespaces fetch namespace config to local and subscribe to updates
 func SubscribeToNamespaces(namespaces ...string) error {
-	return defaultClient.SubscribeToNamespaces(namespaces...)
+	client := getDefaultClient()
+	if client == nil {
+		return ErrNotStarted
+	}
+	return client.SubscribeToNamespaces(namespaces...)
+}
+
+// UnsubscribeFromNamespaces stop polling namespaces and remove their config from local
+func UnsubscribeFromNamespaces(namespaces ...string) error {
+	client := getDefaultClient()
+	if client == nil {
+		return ErrNotStarted
+	}
+	return client.UnsubscribeFromNamespaces(namespaces...)
 }
 
 // GetStringValueWithNameSpace get value from given namespace
 func GetStringValueWithNameSpace(namespace, key, defaultValue string) string {
-	return defaultClient.GetStringValueWithNameSpace(namespace, key, defaultValue)
+	client := getDefaultClient()
+	if client == nil {
+		return defaultValue
+	}
+	return client.GetStringValueWithNameSpace(namespace, key, defaultValue)
 }
 
 // GetStringValue from default namespace
@@ -52,15 +121,54 @@ func GetStringValue(key, defaultValue string) string {
 
 // GetNameSpaceContent get contents of namespace
 func GetNameSpaceContent(namespace, defaultValue string) string {
-	return defaultClient.GetNameSpaceContent(namespace, defaultValue)
+	client := getDefaultClient()
+	if client == nil {
+		return defaultValue
+	}
+	return client.GetNameSpaceContent(namespace, defaultValue)
 }
 
 // GetAllKeys return all config keys in given namespace
 func GetAllKeys(namespace string) []string {
-	return defaultClient.GetAllKeys(namespace)
+	client := getDefaultClient()
+	if client == nil {
+		return nil
+	}
+	return client.GetAllKeys(namespace)
 }
 
 // GetReleaseKey return release key for namespace
 func GetReleaseKey(namespace string) string {
-	return defaultClient.GetReleaseKey(namespace)
+	client := getDefaultClient()
+	if client == nil {
+		return ""
+	}
+	return client.GetReleaseKey(namespace)
+}
+
+// GetCluster return cluster which actually served namespace
+func GetCluster(namespace string) string {
+	client := getDefaultClient()
+	if client == nil {
+		return ""
+	}
+	return client.GetCluster(namespace)
+}
+
+// NewMergedView create a merged view over namespaces, ordered from the highest priority to the lowest
+func NewMergedView(namespaces ...string) (*MergedView, error) {
+	client := getDefaultClient()
+	if client == nil {
+		return nil, ErrNotStarted
+	}
+	return client.NewMergedView(namespaces...)
+}
+
+// WatchConfig set config fields with values of default namespace, and update them on changes
+func WatchConfig(config interface{}) error {
+	client := getDefaultClient()
+	if client == nil {
+		return ErrNotStarted
+	}
+	return client.WatchConfig(config)
 }
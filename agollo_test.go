@@ -1,7 +1,10 @@
 package apollo
 
 import (
+	"context"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"testing"
@@ -19,7 +22,8 @@ func TestMain(m *testing.M) {
 
 func setup() {
 	go func() {
-		if err := mockserver.Run(); err != nil {
+		// teardown shuts the server down, which is not a failure
+		if err := mockserver.Run(); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
@@ -31,7 +35,11 @@ func teardown() {
 	mockserver.Close()
 }
 
-func TestapolloStart(t *testing.T) {
+func TestApolloStart(t *testing.T) {
+	// values set by a previous run wouldn't change
+	mockserver.Delete("client.json", "content")
+	mockserver.Delete("new_namespace.json", "key")
+
 	if err := Start(); err == nil {
 		t.Errorf("Start with default app.properties should return err, got :%v", err)
 		return
@@ -47,7 +55,7 @@ func TestapolloStart(t *testing.T) {
 		return
 	}
 
-	f, err := os.Stat(path.Dir(defaultClient.getDumpFileName()))
+	f, err := os.Stat(path.Dir(getDefaultClient().getDumpFileName()))
 	if err != nil {
 		t.Errorf("dump file dir should exists, got err:%v", err)
 		return
@@ -58,31 +66,29 @@ func TestapolloStart(t *testing.T) {
 		return
 	}
 
-	if err := Stop(); err != nil {
+	if err := Stop(context.Background()); err != nil {
 		t.Errorf("Stop should return nil, got :%v", err)
 		return
 	}
-	os.Remove(defaultClient.getDumpFileName())
+	os.Remove(getDefaultClient().getDumpFileName())
 
 	if err := StartWithConfFile("./testdata/app.properties"); err != nil {
 		t.Errorf("Start with app.properties should return nil, got :%v", err)
 		return
 	}
-	defer Stop()
-	defer os.Remove(defaultClient.getDumpFileName())
+	defer Stop(context.Background())
+	defer os.Remove(getDefaultClient().getDumpFileName())
 
-	if err := defaultClient.loadLocal(defaultClient.getDumpFileName()); err != nil {
+	if err := getDefaultClient().loadLocal(getDefaultClient().getDumpFileName()); err != nil {
 		t.Errorf("loadLocal should return nil, got: %v", err)
 		return
 	}
 
-	mockserver.Set("application", "key", "value")
 	updates := WatchUpdate()
+	mockserver.Set("application", "key", "value")
+	pollNow()
 
-	select {
-	case <-updates:
-	case <-time.After(time.Millisecond * 30000):
-	}
+	waitUpdate(t, updates)
 
 	val := GetStringValue("key", "defaultValue")
 	if val != "value" {
@@ -97,12 +103,10 @@ func TestapolloStart(t *testing.T) {
 	}
 
 	mockserver.Set("application", "key", "newvalue")
-	select {
-	case <-updates:
-	case <-time.After(time.Millisecond * 30000):
-	}
+	pollNow()
+	waitUpdate(t, updates)
 
-	val = defaultClient.GetStringValue("key", "defaultValue")
+	val = getDefaultClient().GetStringValue("key", "defaultValue")
 	if val != "newvalue" {
 		t.Errorf("GetStringValue of key should = newvalue, got %v", val)
 		return
@@ -115,10 +119,8 @@ func TestapolloStart(t *testing.T) {
 	}
 
 	mockserver.Delete("application", "key")
-	select {
-	case <-updates:
-	case <-time.After(time.Millisecond * 30000):
-	}
+	pollNow()
+	waitUpdate(t, updates)
 
 	val = GetStringValue("key", "defaultValue")
 	if val != "defaultValue" {
@@ -133,10 +135,8 @@ func TestapolloStart(t *testing.T) {
 	}
 
 	mockserver.Set("client.json", "content", `{"name":"apollo"}`)
-	select {
-	case <-updates:
-	case <-time.After(time.Millisecond * 30000):
-	}
+	pollNow()
+	waitUpdate(t, updates)
 
 	val = GetNameSpaceContent("client.json", "{}")
 	if val != `{"name":"apollo"}` {
@@ -150,10 +150,8 @@ func TestapolloStart(t *testing.T) {
 	}
 
 	mockserver.Set("new_namespace.json", "key", "1")
-	select {
-	case <-updates:
-	case <-time.After(time.Millisecond * 30000):
-	}
+	pollNow()
+	waitUpdate(t, updates)
 
 	val = GetStringValueWithNameSpace("new_namespace.json", "key", "defaultValue")
 	if val != `1` {
@@ -161,3 +159,89 @@ func TestapolloStart(t *testing.T) {
 		return
 	}
 }
+
+// pollNow trigger a poll of default client instead of waiting for the interval
+func pollNow() {
+	getDefaultClient().longPoller.(*longPoller).trigger()
+}
+
+// waitUpdate wait for the update triggered by pollNow
+func waitUpdate(t *testing.T, updates <-chan *ChangeEvent) {
+	t.Helper()
+	select {
+	case <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("update should be received after poll")
+	}
+}
+
+func TestClientRestart(t *testing.T) {
+	conf, err := NewConf("./testdata/app.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(conf)
+	defer os.Remove(client.getDumpFileName())
+
+	for i := 0; i < 2; i++ {
+		if err := client.Start(); err != nil {
+			t.Fatalf("Start should return nil, got: %v", err)
+		}
+		updates := client.WatchUpdate()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := client.Stop(ctx); err != nil {
+			t.Fatalf("Stop should return nil, got: %v", err)
+		}
+		cancel()
+
+		if _, ok := <-updates; ok {
+			t.Fatal("updates should be closed after Stop")
+		}
+		if _, err := os.Stat(client.getDumpFileName()); err != nil {
+			t.Fatalf("backup should be flushed on Stop, got: %v", err)
+		}
+	}
+}
+
+func TestClientMockServerFaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mockserver.Set("faulty", "key", "value")
+	defer mockserver.ClearFaults()
+	mockserver.ResetRequests()
+
+	conf, err := NewConf("./testdata/app.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.CacheDir = dir
+	conf.NameSpaceNames = []string{"faulty"}
+	client := NewClient(conf)
+
+	mockserver.Inject(mockserver.Fault{Endpoint: mockserver.EndpointConfigs, Namespace: "faulty", Times: 1, Status: http.StatusInternalServerError})
+	if err := client.Start(); err == nil {
+		t.Fatal("Start should fail without backup when config service fails")
+	}
+	if err := client.Start(); err != nil {
+		t.Fatalf("Start should succeed once the fault is gone, got: %v", err)
+	}
+	defer client.Stop(context.Background())
+
+	if value := client.GetStringValueWithNameSpace("faulty", "key", ""); value != "value" {
+		t.Errorf("value should be loaded after retry, got: %q", value)
+	}
+	requests := mockserver.Requests(mockserver.EndpointConfigs)
+	if len(requests) != 2 {
+		t.Fatalf("config should be requested twice, got: %d", len(requests))
+	}
+	for _, req := range requests {
+		if req.AppID != "SampleApp" || req.Cluster != "default" || req.Namespace != "faulty" {
+			t.Errorf("unexpected request: %+v", req)
+		}
+	}
+}
@@ -9,40 +9,38 @@ import (
 	"strings"
 )
 
-func WatchConfig(config interface{}) error {
+// WatchConfig set config fields with values of default namespace, and update them on changes
+func (c *Client) WatchConfig(config interface{}) error {
 	updater, err := newConfigUpdater(config)
 	if err != nil {
 		return err
 	}
 
-	keys := GetAllKeys(defaultNamespace)
+	keys := c.GetAllKeys(defaultNamespace)
 	for _, key := range keys {
 		fieldMeta, ok := updater.fieldsMeta[key]
 		if !ok {
 			continue
 		}
 
-		val := GetStringValue(key, fieldMeta.apolloDefault)
+		val := c.GetStringValue(key, fieldMeta.apolloDefault)
 		if err := updater.setValue(fieldMeta.fieldName, val); err != nil {
 			return err
 		}
 	}
 
-	events := WatchUpdate()
+	events := c.WatchUpdate()
 	go func() {
-		for {
-			select {
-			case event := <-events:
-				allChanges := make(map[string]string)
-				for key, change := range event.Changes {
-					allChanges[key] = change.NewValue
-				}
+		// events is closed when client stops, updates are applied one by one
+		// so callbacks never race with each other
+		for event := range events {
+			allChanges := make(map[string]string)
+			for key, change := range event.Changes {
+				allChanges[key] = change.NewValue
+			}
 
-				go func() {
-					if err := updater.Update(allChanges); err != nil {
-						log.Printf("error update changes: %v", allChanges)
-					}
-				}()
+			if err := updater.Update(allChanges); err != nil {
+				log.Printf("error update changes: %v", allChanges)
 			}
 		}
 	}()
@@ -0,0 +1,48 @@
+package apollotest
+
+import (
+	"github.com/liamylian/apollo-client/internal/faults"
+)
+
+// Endpoint of config service
+type Endpoint = faults.Endpoint
+
+// Endpoints of config service
+const (
+	EndpointNotifications = faults.EndpointNotifications
+	EndpointConfigs       = faults.EndpointConfigs
+	EndpointConfigFiles   = faults.EndpointConfigFiles
+)
+
+// Fault is a failure injected into requests matching Endpoint and Namespace,
+// like a status, latency, truncated or malformed body, reset or hung connection
+type Fault = faults.Fault
+
+// Request is a request received by server
+type Request = faults.Request
+
+// Inject fault into following requests, return a func to remove it.
+// Faults are matched in the order they are injected.
+func (s *Server) Inject(f Fault) (remove func()) {
+	return s.faults.Inject(f)
+}
+
+// ClearFaults remove all injected faults
+func (s *Server) ClearFaults() {
+	s.faults.ClearFaults()
+}
+
+// Requests return requests received at endpoint in order, all requests if endpoint is empty
+func (s *Server) Requests(endpoint Endpoint) []Request {
+	return s.faults.Requests(endpoint)
+}
+
+// RequestCount return count of requests received at endpoint, all requests if endpoint is empty
+func (s *Server) RequestCount(endpoint Endpoint) int {
+	return s.faults.RequestCount(endpoint)
+}
+
+// ResetRequests forget received requests
+func (s *Server) ResetRequests() {
+	s.faults.ResetRequests()
+}
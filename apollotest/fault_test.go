@@ -0,0 +1,118 @@
+package apollotest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerFaults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Publish("application", map[string]string{"key": "value"})
+
+	get := func(path string) (int, []byte, error) {
+		client := &http.Client{Timeout: 200 * time.Millisecond}
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer resp.Body.Close()
+		bts, err := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, bts, err
+	}
+	path := "/configs/SampleApp/default/application"
+
+	// 5xx burst
+	srv.Inject(Fault{Endpoint: EndpointConfigs, Times: 2, Status: http.StatusInternalServerError})
+	for i := 0; i < 2; i++ {
+		status, _, _ := get(path)
+		assert.Equal(t, http.StatusInternalServerError, status)
+	}
+	status, _, _ := get(path)
+	assert.Equal(t, http.StatusOK, status)
+
+	// 404 of a namespace only
+	remove := srv.Inject(Fault{Namespace: "application", Status: http.StatusNotFound})
+	status, _, _ = get(path)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _, _ = get("/configs/SampleApp/default/other")
+	assert.Equal(t, http.StatusNotFound, status)
+	remove()
+
+	var ret map[string]interface{}
+	srv.Inject(Fault{Times: 1, Truncate: true})
+	_, bts, _ := get(path)
+	assert.NotNil(t, json.Unmarshal(bts, &ret))
+
+	srv.Inject(Fault{Times: 1, Malformed: true})
+	_, bts, _ = get(path)
+	assert.NotNil(t, json.Unmarshal(bts, &ret))
+
+	srv.Inject(Fault{Times: 1, Hang: true})
+	_, _, err := get(path)
+	assert.NotNil(t, err)
+
+	srv.Inject(Fault{Times: 1, Latency: 50 * time.Millisecond})
+	start := time.Now()
+	status, _, _ = get(path)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	requests := srv.Requests(EndpointConfigs)
+	assert.Len(t, requests, 9)
+	assert.Equal(t, "SampleApp", requests[0].AppID)
+	assert.Equal(t, "default", requests[0].Cluster)
+	assert.Equal(t, "application", requests[0].Namespace)
+	assert.Equal(t, 0, srv.RequestCount(EndpointNotifications))
+	srv.ResetRequests()
+	assert.Equal(t, 0, srv.RequestCount(""))
+
+	// http client retries GET on reset connection, so reset until removed
+	remove = srv.Inject(Fault{Reset: true})
+	_, _, err = get(path)
+	assert.NotNil(t, err)
+	remove()
+}
+
+func TestClientWithFaults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Publish("application", map[string]string{"key": "value"})
+
+	dir, err := ioutil.TempDir("", "apollotest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// first start fails on 5xx and there is no backup
+	remove := srv.Inject(Fault{Endpoint: EndpointConfigs, Status: http.StatusServiceUnavailable})
+	client := apollo.NewClient(srv.Conf(dir, "application"))
+	assert.NotNil(t, client.Start())
+
+	remove()
+	assert.Nil(t, client.Start())
+	assert.Equal(t, "value", client.GetStringValue("key", ""))
+
+	// backup is used when config service is down
+	assert.Nil(t, client.Stop(context.Background()))
+	srv.Inject(Fault{Endpoint: EndpointConfigs, Malformed: true})
+	restart := apollo.NewClient(srv.Conf(dir, "application"))
+	assert.Nil(t, restart.Start())
+	defer restart.Stop(context.Background())
+	assert.Equal(t, "value", restart.GetStringValue("key", ""))
+
+	notifications := srv.Requests(EndpointNotifications)
+	assert.NotEmpty(t, notifications)
+	assert.Equal(t, "SampleApp", notifications[0].AppID)
+	assert.Contains(t, notifications[0].Query.Get("notifications"), `"namespaceName":"application"`)
+	for _, req := range srv.Requests(EndpointConfigs) {
+		assert.NotEmpty(t, req.Query.Get("ip"))
+	}
+}
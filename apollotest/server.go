@@ -0,0 +1,292 @@
+// Package apollotest provide an in-process fake Apollo config service, to test
+// code using the apollo client. Every Server listens on a random port and has
+// its own state, so tests can run in parallel.
+//
+//	srv := apollotest.NewServer()
+//	defer srv.Close()
+//	srv.Publish("application", map[string]string{"timeout": "100"})
+//	client := apollo.NewClient(srv.Conf(dir, "application"))
+package apollotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+	"github.com/liamylian/apollo-client/internal/faults"
+)
+
+const (
+	// DefaultAppID is app of Server.Publish
+	DefaultAppID = "SampleApp"
+	// DefaultCluster is cluster of Server.Publish
+	DefaultCluster = "default"
+
+	defaultHoldTimeout = time.Second * 30
+)
+
+type notification struct {
+	NamespaceName  string `json:"namespaceName"`
+	NotificationID int64  `json:"notificationId"`
+}
+
+type result struct {
+	AppID          string            `json:"appId"`
+	Cluster        string            `json:"cluster"`
+	NamespaceName  string            `json:"namespaceName"`
+	Configurations map[string]string `json:"configurations"`
+	ReleaseKey     string            `json:"releaseKey"`
+}
+
+// namespace is the latest release of a namespace
+type namespace struct {
+	configurations map[string]string
+	releaseKey     string
+	notificationID int64
+}
+
+// Server is a fake Apollo config service
+type Server struct {
+	// URL of the server, like http://127.0.0.1:port
+	URL string
+
+	server *httptest.Server
+
+	lock        sync.Mutex
+	seq         int64
+	namespaces  map[string]*namespace
+	changed     chan struct{}
+	holdTimeout time.Duration
+
+	faults faults.Injector
+}
+
+// NewServer start a server on a random port
+func NewServer() *Server {
+	s := &Server{
+		namespaces:  map[string]*namespace{},
+		changed:     make(chan struct{}),
+		holdTimeout: defaultHoldTimeout,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notifications/v2", s.faults.Handler(EndpointNotifications, s.handleNotifications))
+	mux.HandleFunc("/configs/", s.faults.Handler(EndpointConfigs, s.handleConfigs))
+	mux.HandleFunc("/configfiles/json/", s.faults.Handler(EndpointConfigFiles, s.handleConfigFiles))
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shut down the server, and release held long polls
+func (s *Server) Close() {
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// SetHoldTimeout set how long a long poll is held without changes before 304, default 30s
+func (s *Server) SetHoldTimeout(timeout time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.holdTimeout = timeout
+}
+
+// Conf return conf of DefaultAppID and DefaultCluster pointed to the server
+func (s *Server) Conf(cacheDir string, namespaces ...string) *apollo.Conf {
+	return &apollo.Conf{
+		AppID:          DefaultAppID,
+		Cluster:        DefaultCluster,
+		NameSpaceNames: namespaces,
+		CacheDir:       cacheDir,
+		MetaAddr:       s.URL,
+	}
+}
+
+// Publish release namespace of DefaultAppID and DefaultCluster with configurations
+func (s *Server) Publish(namespace string, configurations map[string]string) {
+	s.PublishApp(DefaultAppID, DefaultCluster, namespace, configurations)
+}
+
+// PublishApp release namespace of app and cluster with configurations, which replace
+// all previous ones. Clients long polling the namespace are notified.
+func (s *Server) PublishApp(appID, cluster, namespace string, configurations map[string]string) {
+	kv := make(map[string]string, len(configurations))
+	for k, v := range configurations {
+		kv[k] = v
+	}
+	s.update(appID, cluster, namespace, func(map[string]string) map[string]string { return kv })
+}
+
+// Set release namespace of DefaultAppID and DefaultCluster with key changed
+func (s *Server) Set(namespace, key, value string) {
+	s.update(DefaultAppID, DefaultCluster, namespace, func(kv map[string]string) map[string]string {
+		kv[key] = value
+		return kv
+	})
+}
+
+// Delete release namespace of DefaultAppID and DefaultCluster without keys
+func (s *Server) Delete(namespace string, keys ...string) {
+	s.update(DefaultAppID, DefaultCluster, namespace, func(kv map[string]string) map[string]string {
+		for _, key := range keys {
+			delete(kv, key)
+		}
+		return kv
+	})
+}
+
+// Remove namespace of app and cluster, then it's not found
+func (s *Server) Remove(appID, cluster, namespace string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.namespaces, key(appID, cluster, namespace))
+}
+
+// ReleaseKey return release key of namespace of app and cluster, empty if not published
+func (s *Server) ReleaseKey(appID, cluster, namespace string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ns, ok := s.namespaces[key(appID, cluster, namespace)]; ok {
+		return ns.releaseKey
+	}
+	return ""
+}
+
+// update namespace with a copy of its configurations, then wake up long polls
+func (s *Server) update(appID, cluster, name string, fn func(kv map[string]string) map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	kv := map[string]string{}
+	if ns, ok := s.namespaces[key(appID, cluster, name)]; ok {
+		for k, v := range ns.configurations {
+			kv[k] = v
+		}
+	}
+
+	s.seq++
+	s.namespaces[key(appID, cluster, name)] = &namespace{
+		configurations: fn(kv),
+		releaseKey:     fmt.Sprintf("%s-%x-%d", time.Now().Format("20060102150405"), hash(appID+cluster+name), s.seq),
+		notificationID: s.seq,
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func key(appID, cluster, namespace string) string {
+	return appID + "+" + cluster + "+" + namespace
+}
+
+// hash string, to make release keys differ between namespaces
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// changes return notifications newer than the client's, and a channel closed on next change
+func (s *Server) changes(appID, cluster string, notifications []notification) ([]notification, <-chan struct{}, time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var changes []notification
+	for _, n := range notifications {
+		ns, ok := s.namespaces[key(appID, cluster, n.NamespaceName)]
+		if !ok || ns.notificationID == n.NotificationID {
+			continue
+		}
+		changes = append(changes, notification{NamespaceName: n.NamespaceName, NotificationID: ns.notificationID})
+	}
+	return changes, s.changed, s.holdTimeout
+}
+
+func (s *Server) handleNotifications(rw http.ResponseWriter, req *http.Request) {
+	appID, cluster := req.FormValue("appId"), req.FormValue("cluster")
+	var notifications []notification
+	if err := json.Unmarshal([]byte(req.FormValue("notifications")), &notifications); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes, changed, holdTimeout := s.changes(appID, cluster, notifications)
+	timer := time.NewTimer(holdTimeout)
+	defer timer.Stop()
+	for len(changes) == 0 {
+		select {
+		case <-changed:
+			changes, changed, _ = s.changes(appID, cluster, notifications)
+		case <-timer.C:
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+	writeJSON(rw, changes)
+}
+
+// lookup namespace from path /{prefix}/{appId}/{cluster}/{namespace}
+func (s *Server) lookup(path, prefix string) (*result, bool) {
+	strs := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	if len(strs) != 3 {
+		return nil, false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ns, ok := s.namespaces[key(strs[0], strs[1], strs[2])]
+	if !ok {
+		return nil, false
+	}
+	return &result{
+		AppID:          strs[0],
+		Cluster:        strs[1],
+		NamespaceName:  strs[2],
+		Configurations: ns.configurations,
+		ReleaseKey:     ns.releaseKey,
+	}, true
+}
+
+func (s *Server) handleConfigs(rw http.ResponseWriter, req *http.Request) {
+	ret, ok := s.lookup(req.URL.Path, "/configs/")
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	if req.FormValue("releaseKey") == ret.ReleaseKey {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(rw, ret)
+}
+
+func (s *Server) handleConfigFiles(rw http.ResponseWriter, req *http.Request) {
+	ret, ok := s.lookup(req.URL.Path, "/configfiles/json/")
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	writeJSON(rw, ret.Configurations)
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	rw.Write(bts)
+}
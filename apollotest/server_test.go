@@ -0,0 +1,90 @@
+package apollotest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerWithClient(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		i := i
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+
+			srv := NewServer()
+			defer srv.Close()
+			srv.Publish("application", map[string]string{"index": fmt.Sprint(i)})
+
+			dir, err := ioutil.TempDir("", "apollotest")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			client := apollo.NewClient(srv.Conf(dir, "application"))
+			assert.Nil(t, client.Start())
+			defer client.Stop(context.Background())
+			assert.Equal(t, fmt.Sprint(i), client.GetStringValue("index", ""))
+			assert.Equal(t, srv.ReleaseKey(DefaultAppID, DefaultCluster, "application"), client.GetReleaseKey("application"))
+
+			sub := client.Subscribe()
+			defer sub.Close()
+			srv.Set("application", "timeout", "100")
+
+			select {
+			case event := <-sub.Events():
+				assert.Equal(t, "100", event.Changes["timeout"].NewValue)
+			case <-time.After(5 * time.Second):
+				t.Fatal("change should be notified")
+			}
+		})
+	}
+}
+
+func TestServerProtocol(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetHoldTimeout(100 * time.Millisecond)
+	srv.PublishApp("App1", "SHAJQ", "application", map[string]string{"key": "1"})
+	srv.PublishApp("App2", "default", "application", map[string]string{"key": "2"})
+
+	get := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	releaseKey := srv.ReleaseKey("App1", "SHAJQ", "application")
+	assert.NotEqual(t, releaseKey, srv.ReleaseKey("App2", "default", "application"))
+	assert.Equal(t, http.StatusOK, get("/configs/App1/SHAJQ/application"))
+	assert.Equal(t, http.StatusNotModified, get("/configs/App1/SHAJQ/application?releaseKey="+releaseKey))
+	assert.Equal(t, http.StatusNotFound, get("/configs/App1/default/application"))
+	assert.Equal(t, http.StatusOK, get("/configfiles/json/App2/default/application"))
+
+	// up to date notifications are held, then 304
+	notifications := url.QueryEscape(`[{"namespaceName":"application","notificationId":1}]`)
+	start := time.Now()
+	assert.Equal(t, http.StatusNotModified, get("/notifications/v2?appId=App1&cluster=SHAJQ&notifications="+notifications))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	// held long poll returns on publish
+	srv.SetHoldTimeout(5 * time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		srv.PublishApp("App1", "SHAJQ", "application", map[string]string{"key": "3"})
+	}()
+	start = time.Now()
+	assert.Equal(t, http.StatusOK, get("/notifications/v2?appId=App1&cluster=SHAJQ&notifications="+notifications))
+	assert.True(t, time.Since(start) < time.Second)
+
+	srv.Remove("App1", "SHAJQ", "application")
+	assert.Equal(t, http.StatusNotFound, get("/configs/App1/SHAJQ/application"))
+}
@@ -1,14 +1,28 @@
 package apollo
 
 import (
+	"bytes"
+	"crypto/cipher"
 	"encoding/gob"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
+// encryptedDumpHeader mark a dump file encrypted with backup keys
+var encryptedDumpHeader = []byte("APOLLO-ENC-V1\n")
+
+// ErrBackupKeyMismatch returned when none of backup keys can decrypt the dump file
+var ErrBackupKeyMismatch = errors.New("no backup key can decrypt dump file")
+
 type namespaceCache struct {
 	lock   sync.Mutex
 	caches map[string]*cache
+
+	// aeads encrypt dump file with the first one, and try all of them on load
+	aeads []cipher.AEAD
 }
 
 func newNamespaceCahce() *namespaceCache {
@@ -30,6 +44,56 @@ func (n *namespaceCache) mustGetCache(namespace string) *cache {
 	return cache
 }
 
+// setBackupKeys set AES keys used to encrypt dump file, the first key is used to
+// encrypt, and all keys are tried in order to decrypt, which make key rotation possible
+func (n *namespaceCache) setBackupKeys(keys [][]byte) error {
+	var aeads []cipher.AEAD
+	for _, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return err
+		}
+		aeads = append(aeads, aead)
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.aeads = aeads
+	return nil
+}
+
+func (n *namespaceCache) getCache(namespace string) (*cache, bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	ret, ok := n.caches[namespace]
+	return ret, ok
+}
+
+// remove cache of namespace, return its kv
+func (n *namespaceCache) remove(namespace string) map[string]string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	cache, ok := n.caches[namespace]
+	if !ok {
+		return nil
+	}
+	delete(n.caches, namespace)
+	return cache.dump()
+}
+
+func (n *namespaceCache) namespaces() []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	var ret []string
+	for namespace := range n.caches {
+		ret = append(ret, namespace)
+	}
+	return ret
+}
+
 func (n *namespaceCache) drain() {
 	n.lock.Lock()
 	defer n.lock.Unlock()
@@ -49,27 +113,40 @@ func (n *namespaceCache) dump(name string) error {
 		dumps[namespace] = cache.dump()
 	}
 
-	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&dumps); err != nil {
 		return err
 	}
-	defer f.Close()
 
-	return gob.NewEncoder(f).Encode(&dumps)
+	bts := buf.Bytes()
+	if len(n.aeads) > 0 {
+		sealed, err := seal(n.aeads[0], bts)
+		if err != nil {
+			return err
+		}
+		bts = append(append([]byte{}, encryptedDumpHeader...), sealed...)
+	}
+
+	return writeFile(name, bts, 0600)
 }
 
 func (n *namespaceCache) load(name string) error {
 	n.drain()
 
-	f, err := os.OpenFile(name, os.O_RDONLY, 0755)
+	bts, err := ioutil.ReadFile(name)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+
+	if bytes.HasPrefix(bts, encryptedDumpHeader) {
+		if bts, err = n.decryptDump(bts[len(encryptedDumpHeader):]); err != nil {
+			return err
+		}
+	}
 
 	var dumps = map[string]map[string]string{}
 
-	if err := gob.NewDecoder(f).Decode(&dumps); err != nil {
+	if err := gob.NewDecoder(bytes.NewReader(bts)).Decode(&dumps); err != nil {
 		return err
 	}
 
@@ -83,6 +160,64 @@ func (n *namespaceCache) load(name string) error {
 	return nil
 }
 
+// ReadBackup decode backup file in CacheDir, return config of every namespace.
+// Encrypted backup is decrypted by backupKeys, see Conf.BackupKeys.
+func ReadBackup(name string, backupKeys ...string) (map[string]map[string]string, error) {
+	keys, err := (&Conf{BackupKeys: backupKeys}).backupKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	caches := newNamespaceCahce()
+	if err := caches.setBackupKeys(keys); err != nil {
+		return nil, err
+	}
+	if err := caches.load(name); err != nil {
+		return nil, err
+	}
+
+	var dumps = map[string]map[string]string{}
+	for _, namespace := range caches.namespaces() {
+		dumps[namespace] = caches.mustGetCache(namespace).dump()
+	}
+	return dumps, nil
+}
+
+func (n *namespaceCache) decryptDump(bts []byte) ([]byte, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, aead := range n.aeads {
+		if plaintext, err := open(aead, bts); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrBackupKeyMismatch
+}
+
+// writeFile write data to a temp file then rename it to name, so the file is
+// never left half written, and always has the given perm
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
 type cache struct {
 	kv sync.Map
 }
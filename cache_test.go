@@ -1,8 +1,10 @@
 package apollo
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
 )
 
@@ -64,3 +66,91 @@ func TestCacheDump(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestCacheDumpEncrypted(t *testing.T) {
+	oldKey := []byte("0123456789abcdef")
+	newKey := []byte("fedcba9876543210")
+
+	var caches = newNamespaceCahce()
+	defer caches.drain()
+	if err := caches.setBackupKeys([][]byte{oldKey}); err != nil {
+		t.Fatal(err)
+	}
+	caches.mustGetCache("namespace").set("password", "secret")
+
+	dir, err := ioutil.TempDir("", "apollo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "dump")
+
+	if err := caches.dump(name); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Mode().Perm() != 0600 {
+		t.Errorf("dump file mode should be 0600, got %v", f.Mode().Perm())
+	}
+
+	bts, _ := ioutil.ReadFile(name)
+	if bytes.Contains(bts, []byte("secret")) {
+		t.Error("dump file should not contain plaintext")
+	}
+
+	var restore = newNamespaceCahce()
+	defer restore.drain()
+	if err := restore.load(name); err != ErrBackupKeyMismatch {
+		t.Errorf("load without key should return ErrBackupKeyMismatch, got %v", err)
+	}
+
+	// rotate key: encrypt with new key, still able to load file encrypted with old key
+	restore.setBackupKeys([][]byte{newKey, oldKey})
+	if err := restore.load(name); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := restore.mustGetCache("namespace").get("password"); val != "secret" {
+		t.FailNow()
+	}
+
+	if err := restore.dump(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := caches.load(name); err != ErrBackupKeyMismatch {
+		t.Errorf("load with old key only should return ErrBackupKeyMismatch, got %v", err)
+	}
+}
+
+func TestReadBackup(t *testing.T) {
+	var caches = newNamespaceCahce()
+	defer caches.drain()
+	if err := caches.setBackupKeys([][]byte{[]byte("0123456789abcdef")}); err != nil {
+		t.Fatal(err)
+	}
+	caches.mustGetCache("namespace").set("password", "secret")
+
+	dir, err := ioutil.TempDir("", "apollo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "dump")
+	if err := caches.dump(name); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadBackup(name); err != ErrBackupKeyMismatch {
+		t.Errorf("ReadBackup without key should return ErrBackupKeyMismatch, got %v", err)
+	}
+	dumps, err := ReadBackup(name, "MDEyMzQ1Njc4OWFiY2RlZg==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dumps["namespace"]["password"] != "secret" {
+		t.Errorf("ReadBackup should decrypt backup, got %v", dumps)
+	}
+}
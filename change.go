@@ -1,5 +1,11 @@
 package apollo
 
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
 // ChangeType for a key
 type ChangeType int
 
@@ -25,10 +31,56 @@ func (c ChangeType) String() string {
 	return "UNKNOW"
 }
 
+// EventSource is where changes come from. The client has no local override of
+// values, so there is no source for overrides.
+type EventSource int
+
+const (
+	// SourceRemote changes fetched from apollo config service
+	SourceRemote EventSource = iota
+	// SourceBackup changes loaded from local backup file
+	SourceBackup
+	// SourceSnapshot synthetic changes add all current contents of a namespace on subscribe
+	SourceSnapshot
+	// SourceUnsubscribe synthetic changes delete all contents of an unsubscribed namespace
+	SourceUnsubscribe
+)
+
+func (s EventSource) String() string {
+	switch s {
+	case SourceRemote:
+		return "REMOTE"
+	case SourceBackup:
+		return "BACKUP"
+	case SourceSnapshot:
+		return "SNAPSHOT"
+	case SourceUnsubscribe:
+		return "UNSUBSCRIBE"
+	}
+
+	return "UNKNOW"
+}
+
 // ChangeEvent change event
 type ChangeEvent struct {
+	// Sequence is monotonic increasing for events of a client, there may be gaps
+	// if events are coalesced for a lagging subscriber
+	Sequence  uint64
 	Namespace string
 	Changes   map[string]*Change
+
+	// AppID and Cluster the release belongs to
+	AppID   string
+	Cluster string
+	// OldReleaseKey and ReleaseKey of the release caused the changes, a derived
+	// change of another namespace carries the release of the referenced namespace
+	OldReleaseKey string
+	ReleaseKey    string
+	// NotificationID of the notification triggered the fetch, or -1 if unknown
+	NotificationID int
+	// ReceivedAt is the time changes are received
+	ReceivedAt time.Time
+	Source     EventSource
 }
 
 // Change represent a single key change
@@ -36,6 +88,42 @@ type Change struct {
 	OldValue   string
 	NewValue   string
 	ChangeType ChangeType
+	// Derived is true if value is not changed itself, but a key it references by placeholder changed
+	Derived bool
+	// Err is why a value can't be resolved, like a failed decryption, the value is left empty.
+	// It's encoded as its message in JSON.
+	Err error
+}
+
+// jsonChange is Change with Err as message
+type jsonChange struct {
+	OldValue   string
+	NewValue   string
+	ChangeType ChangeType
+	Derived    bool
+	Err        string `json:",omitempty"`
+}
+
+// MarshalJSON encode Err as its message, as an error is encoded as {}
+func (c Change) MarshalJSON() ([]byte, error) {
+	jc := jsonChange{OldValue: c.OldValue, NewValue: c.NewValue, ChangeType: c.ChangeType, Derived: c.Derived}
+	if c.Err != nil {
+		jc.Err = c.Err.Error()
+	}
+	return json.Marshal(&jc)
+}
+
+// UnmarshalJSON decode Err from its message
+func (c *Change) UnmarshalJSON(bts []byte) error {
+	var jc jsonChange
+	if err := json.Unmarshal(bts, &jc); err != nil {
+		return err
+	}
+	*c = Change{OldValue: jc.OldValue, NewValue: jc.NewValue, ChangeType: jc.ChangeType, Derived: jc.Derived}
+	if jc.Err != "" {
+		c.Err = errors.New(jc.Err)
+	}
+	return nil
 }
 
 func makeDeleteChange(_, value string) *Change {
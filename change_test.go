@@ -1,6 +1,9 @@
 package apollo
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestChangeType(t *testing.T) {
 	var tps = []ChangeType{ADD, MODIFY, DELETE, ChangeType(-1)}
@@ -32,3 +35,37 @@ func TestMakeAddChange(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestEventSource(t *testing.T) {
+	var srcs = []EventSource{SourceRemote, SourceBackup, SourceSnapshot, SourceUnsubscribe, EventSource(-1)}
+	var strs = []string{"REMOTE", "BACKUP", "SNAPSHOT", "UNSUBSCRIBE", "UNKNOW"}
+	for i, src := range srcs {
+		if src.String() != strs[i] {
+			t.FailNow()
+		}
+	}
+}
+
+func TestChangeJSON(t *testing.T) {
+	change := &Change{ChangeType: MODIFY, OldValue: "old", Err: ErrInvalidCiphertext}
+	bts, err := json.Marshal(map[string]*Change{"key": change})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"key":{"OldValue":"old","NewValue":"","ChangeType":1,"Derived":false,"Err":"` + ErrInvalidCiphertext.Error() + `"}}`; string(bts) != want {
+		t.Errorf("Err should be encoded as message, got %s", bts)
+	}
+
+	var decoded map[string]*Change
+	if err := json.Unmarshal(bts, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded["key"]; got.OldValue != "old" || got.Err == nil || got.Err.Error() != ErrInvalidCiphertext.Error() {
+		t.Errorf("Err should be decoded from message, got %+v", got)
+	}
+
+	bts, _ = json.Marshal(makeAddChange("key", "value"))
+	if string(bts) != `{"OldValue":"","NewValue":"value","ChangeType":0,"Derived":false}` {
+		t.Errorf("Err should be omitted if nil, got %s", bts)
+	}
+}
@@ -2,34 +2,57 @@ package apollo
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"sort"
+	"sync"
+	"time"
 )
 
-// Client for apollo
+// Client for apollo. Multiple Clients can coexist in a process, each has its own
+// caches, long poller, subscribers and backup file named by AppID and Cluster in CacheDir.
 type Client struct {
 	conf *Conf
 
-	updateChan chan *ChangeEvent
+	lazyLoader *lazyLoader
+	refresher  *refresher
+
+	dispatcher *dispatcher
+	updateLock sync.Mutex
+	updateSub  *Subscription
+	// syncLock serialize updating caches with publishing changes, so snapshot
+	// on subscribe is consistent with later changes
+	syncLock sync.Mutex
+
+	listenerLock sync.Mutex
+	listeners    []*changeListener
+	dispatchers  []*dispatcher
 
 	caches         *namespaceCache
 	releaseKeyRepo *cache
+	clusterRepo    *cache
 
 	longPoller poller
 	requester  requester
 
-	ctx    context.Context
-	cancel context.CancelFunc
+	// lifecycleLock serialize Start and Stop
+	lifecycleLock sync.Mutex
+	running       bool
+
+	decryptorLock sync.RWMutex
+	decryptor     Decryptor
 }
 
+// changeListener is notified synchronously with changes before they are delivered to subscribers
+type changeListener func(event *ChangeEvent)
+
 // result of query config
 type result struct {
-	// AppID          string            `json:"appId"`
-	// Cluster        string            `json:"cluster"`
+	AppID          string            `json:"appId"`
+	Cluster        string            `json:"cluster"`
 	NamespaceName  string            `json:"namespaceName"`
 	Configurations map[string]string `json:"configurations"`
 	ReleaseKey     string            `json:"releaseKey"`
@@ -41,17 +64,42 @@ func NewClient(conf *Conf) *Client {
 		conf:           conf,
 		caches:         newNamespaceCahce(),
 		releaseKeyRepo: newCache(),
+		clusterRepo:    newCache(),
+		dispatcher:     newDispatcher(),
+		lazyLoader:     newLazyLoader(),
 
-		requester: newHTTPRequester(&http.Client{Timeout: queryTimeout}),
+		requester: newHTTPRequester(&http.Client{Timeout: queryTimeout}, conf.maxResponseBytes()),
 	}
 
 	client.longPoller = newLongPoller(conf, longPollInterval, client.handleNamespaceUpdate)
-	client.ctx, client.cancel = context.WithCancel(context.Background())
 	return client
 }
 
-// Start sync config
+// Start sync config, ErrAlreadyStarted is returned if client is running
 func (c *Client) Start() error {
+	c.lifecycleLock.Lock()
+	defer c.lifecycleLock.Unlock()
+
+	if c.running {
+		return ErrAlreadyStarted
+	}
+	c.conf.resolveEnv()
+
+	decryptor, err := c.conf.newDecryptor()
+	if err != nil {
+		return err
+	}
+	c.decryptorLock.Lock()
+	c.decryptor = decryptor
+	c.decryptorLock.Unlock()
+
+	backupKeys, err := c.conf.backupKeys()
+	if err != nil {
+		return err
+	}
+	if err := c.caches.setBackupKeys(backupKeys); err != nil {
+		return err
+	}
 
 	// check cache dir
 	if err := c.autoCreateCacheDir(); err != nil {
@@ -64,29 +112,143 @@ func (c *Client) Start() error {
 	}
 
 	// start fetch update
-	go c.longPoller.start()
+	c.longPoller.start()
+	c.startRefresh()
+	c.running = true
 
 	return nil
 }
 
 // handleNamespaceUpdate sync config for namespace, delivery changes to subscriber
-func (c *Client) handleNamespaceUpdate(namespace string) error {
-	change, err := c.sync(namespace)
-	if err != nil || change == nil {
+func (c *Client) handleNamespaceUpdate(ctx context.Context, notification *notification) error {
+	result, err := c.fetch(ctx, notification.NamespaceName)
+	if err != nil || result == nil {
 		return err
 	}
 
-	c.deliveryChangeEvent(change)
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	// unsubscribed while fetching
+	if !c.longPoller.hasNamespace(notification.NamespaceName) {
+		return nil
+	}
+	events := c.handleResult(result)
+	for _, event := range events {
+		event.NotificationID = notification.NotificationID
+	}
+	c.publish(events)
 	return nil
 }
 
-// Stop sync config
-func (c *Client) Stop() error {
-	c.longPoller.stop()
-	c.cancel()
-	// close(c.updateChan)
-	c.updateChan = nil
-	return nil
+// publish events to listeners and subscribers
+func (c *Client) publish(events []*ChangeEvent) {
+	for _, event := range events {
+		c.notifyListeners(event)
+		c.deliveryChangeEvent(event)
+	}
+}
+
+// addListener register a listener for changes of all namespaces, it's removed
+// by calling the returned func
+func (c *Client) addListener(listener changeListener) func() {
+	c.listenerLock.Lock()
+	defer c.listenerLock.Unlock()
+
+	l := &listener
+	c.listeners = append(c.listeners, l)
+	return func() {
+		c.listenerLock.Lock()
+		defer c.listenerLock.Unlock()
+
+		for i, v := range c.listeners {
+			if v == l {
+				c.listeners = append(c.listeners[:i:i], c.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) notifyListeners(event *ChangeEvent) {
+	c.listenerLock.Lock()
+	listeners := c.listeners
+	c.listenerLock.Unlock()
+
+	for _, listener := range listeners {
+		(*listener)(event)
+	}
+}
+
+func (c *Client) isRunning() bool {
+	c.lifecycleLock.Lock()
+	defer c.lifecycleLock.Unlock()
+
+	return c.running
+}
+
+// Stop sync config, wait for long polling to exit, flush backup file and close
+// all subscriber channels. Error is returned if ctx is done before all of them
+// finished. A stopped client can be started again.
+func (c *Client) Stop(ctx context.Context) error {
+	c.lifecycleLock.Lock()
+	defer c.lifecycleLock.Unlock()
+
+	if !c.running {
+		return ErrNotStarted
+	}
+	c.running = false
+
+	var ret error
+	if err := c.longPoller.stop(ctx); err != nil {
+		ret = err
+	}
+	if err := c.stopRefresh(ctx); err != nil && ret == nil {
+		ret = err
+	}
+
+	if err := c.dump(c.getDumpFileName()); err != nil && ret == nil {
+		ret = err
+	}
+
+	c.updateLock.Lock()
+	c.updateSub = nil
+	c.updateLock.Unlock()
+
+	for _, d := range c.getDispatchers() {
+		if err := d.close(ctx); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// addDispatcher register dispatcher of a view, it's closed on Stop
+func (c *Client) addDispatcher(d *dispatcher) {
+	c.listenerLock.Lock()
+	defer c.listenerLock.Unlock()
+
+	c.dispatchers = append(c.dispatchers, d)
+}
+
+// removeDispatcher unregister dispatcher of a closed view
+func (c *Client) removeDispatcher(d *dispatcher) {
+	c.listenerLock.Lock()
+	defer c.listenerLock.Unlock()
+
+	for i, v := range c.dispatchers {
+		if v == d {
+			c.dispatchers = append(c.dispatchers[:i:i], c.dispatchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Client) getDispatchers() []*dispatcher {
+	c.listenerLock.Lock()
+	defer c.listenerLock.Unlock()
+
+	return append([]*dispatcher{c.dispatcher}, c.dispatchers...)
 }
 
 // fetchAllCinfig fetch from remote, if failed load from local file
@@ -98,9 +260,47 @@ func (c *Client) preload() error {
 	return nil
 }
 
-// loadLocal load caches from local file
+// loadLocal load caches from local file, and publish changes to subscribers
 func (c *Client) loadLocal(name string) error {
-	return c.caches.load(name)
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	var olds = map[string]map[string]string{}
+	for _, namespace := range c.caches.namespaces() {
+		olds[namespace] = c.mustGetCache(namespace).dump()
+	}
+
+	if err := c.caches.load(name); err != nil {
+		return err
+	}
+
+	var loaded = map[string]map[string]string{}
+	for namespace := range olds {
+		loaded[namespace] = nil
+	}
+	for _, namespace := range c.caches.namespaces() {
+		loaded[namespace] = c.mustGetCache(namespace).dump()
+	}
+
+	for namespace, kv := range loaded {
+		old := olds[namespace]
+		changes := diff(old, kv)
+		if len(changes) == 0 {
+			continue
+		}
+		releaseKey := c.GetReleaseKey(namespace)
+		c.publish(c.makeChangeEvents(&ChangeEvent{
+			Namespace:      namespace,
+			AppID:          c.conf.AppID,
+			Cluster:        c.conf.Cluster,
+			OldReleaseKey:  releaseKey,
+			ReleaseKey:     releaseKey,
+			NotificationID: defaultNotificationID,
+			ReceivedAt:     time.Now(),
+			Source:         SourceBackup,
+		}, old, changes))
+	}
+	return nil
 }
 
 // dump caches to file
@@ -110,10 +310,66 @@ func (c *Client) dump(name string) error {
 
 // WatchUpdate get all updates
 func (c *Client) WatchUpdate() <-chan *ChangeEvent {
-	if c.updateChan == nil {
-		c.updateChan = make(chan *ChangeEvent, 32)
+	c.updateLock.Lock()
+	defer c.updateLock.Unlock()
+
+	if c.updateSub == nil {
+		c.updateSub = c.Subscribe()
+	}
+	return c.updateSub.Events()
+}
+
+// Subscribe to changes of all namespaces, events beyond buffer are coalesced
+// if subscriber lags, so a slow subscriber never blocks config updates
+func (c *Client) Subscribe(opts ...SubscribeOption) *Subscription {
+	o := newSubscribeOptions(opts)
+
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	var snapshot []*ChangeEvent
+	if o.snapshot {
+		snapshot = c.snapshot()
+	}
+	return c.dispatcher.subscribe(o.buffer, snapshot)
+}
+
+// snapshot make events add all current contents of each namespace
+func (c *Client) snapshot() []*ChangeEvent {
+	var events []*ChangeEvent
+	namespaces := c.caches.namespaces()
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		releaseKey := c.GetReleaseKey(namespace)
+		events = append(events, c.makeSnapshotEvent(&ChangeEvent{
+			Namespace:      namespace,
+			AppID:          c.conf.AppID,
+			Cluster:        c.conf.Cluster,
+			OldReleaseKey:  releaseKey,
+			ReleaseKey:     releaseKey,
+			NotificationID: defaultNotificationID,
+			ReceivedAt:     time.Now(),
+			Source:         SourceSnapshot,
+		}))
+	}
+	return events
+}
+
+// makeSnapshotEvent fill meta with changes add all resolved values of namespace
+func (c *Client) makeSnapshotEvent(meta *ChangeEvent) *ChangeEvent {
+	interpolator := c.newInterpolator(c.lookup)
+	meta.Changes = map[string]*Change{}
+	for _, key := range c.GetAllKeys(meta.Namespace) {
+		val, ok, err := interpolator.resolve(meta.Namespace, key)
+		if err != nil {
+			log.Printf("[apollo] err resolve %s of %s: %v", key, meta.Namespace, err)
+			continue
+		}
+		if ok {
+			meta.Changes[key] = makeAddChange(key, val)
+		}
 	}
-	return c.updateChan
+	return meta
 }
 
 func (c *Client) mustGetCache(namespace string) *cache {
@@ -125,11 +381,60 @@ func (c *Client) SubscribeToNamespaces(namespaces ...string) error {
 	return c.longPoller.addNamespaces(namespaces...)
 }
 
+// UnsubscribeFromNamespaces stop polling namespaces, remove them from local cache
+// and backup file, and publish a final event deleting all their keys. Writers check
+// the namespace is still subscribed under syncLock before applying a result, so a
+// removed namespace is never recreated by an in-flight fetch.
+func (c *Client) UnsubscribeFromNamespaces(namespaces ...string) error {
+	removed := c.longPoller.removeNamespaces(namespaces...)
+	if len(removed) == 0 {
+		return nil
+	}
+
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	var events []*ChangeEvent
+	for _, namespace := range removed {
+		releaseKey := c.GetReleaseKey(namespace)
+		c.releaseKeyRepo.delete(namespace)
+		c.clusterRepo.delete(namespace)
+
+		old := c.caches.remove(namespace)
+		changes := diff(old, nil)
+		if len(changes) == 0 {
+			continue
+		}
+		events = append(events, c.makeChangeEvents(&ChangeEvent{
+			Namespace:      namespace,
+			AppID:          c.conf.AppID,
+			Cluster:        c.conf.Cluster,
+			OldReleaseKey:  releaseKey,
+			NotificationID: defaultNotificationID,
+			ReceivedAt:     time.Now(),
+			Source:         SourceUnsubscribe,
+		}, old, changes)...)
+	}
+
+	err := c.dump(c.getDumpFileName())
+	c.publish(events)
+	return err
+}
+
 // GetStringValueWithNameSpace get value from given namespace
 func (c *Client) GetStringValueWithNameSpace(namespace, key, defaultValue string) string {
-	cache := c.mustGetCache(namespace)
-	if ret, ok := cache.get(key); ok && ret != "" {
-		return ret
+	if err := c.ensureNamespace(namespace); err != nil {
+		log.Printf("[apollo] err load namespace %s: %v", namespace, err)
+		return defaultValue
+	}
+
+	val, ok, err := c.newInterpolator(c.lookup).resolve(namespace, key)
+	if err != nil {
+		log.Printf("[apollo] err resolve %s of %s: %v", key, namespace, err)
+		return defaultValue
+	}
+	if ok && val != "" {
+		return val
 	}
 	return defaultValue
 }
@@ -146,8 +451,20 @@ func (c *Client) GetNameSpaceContent(namespace, defaultValue string) string {
 
 // GetAllKeys return all config keys in given namespace
 func (c *Client) GetAllKeys(namespace string) []string {
+	if err := c.ensureNamespace(namespace); err != nil {
+		log.Printf("[apollo] err load namespace %s: %v", namespace, err)
+		return nil
+	}
+	return c.keys(namespace)
+}
+
+// keys of namespace in cache, without lazy loading, so it's safe under syncLock
+func (c *Client) keys(namespace string) []string {
 	var keys []string
-	cache := c.mustGetCache(namespace)
+	cache, ok := c.caches.getCache(namespace)
+	if !ok {
+		return nil
+	}
 	cache.kv.Range(func(key, value interface{}) bool {
 		str, ok := key.(string)
 		if ok {
@@ -158,38 +475,91 @@ func (c *Client) GetAllKeys(namespace string) []string {
 	return keys
 }
 
-// sync namespace config
-func (c *Client) sync(namesapce string) (*ChangeEvent, error) {
+// fetch namespace config, return nil if not modified. If namespace is not found
+// in the configured cluster, clusters of Conf.clusters are tried in order.
+func (c *Client) fetch(ctx context.Context, namesapce string) (*result, error) {
 	releaseKey := c.GetReleaseKey(namesapce)
-	url := configURL(c.conf, namesapce, releaseKey)
-	bts, err := c.requester.request(url)
-	if err != nil || len(bts) == 0 {
-		return nil, err
+
+	var err error
+	for _, cluster := range c.conf.clusters() {
+		var ret *result
+		ret, err = c.fetchCluster(ctx, cluster, namesapce, releaseKey)
+		if err == ErrorStatusNotFound {
+			continue
+		}
+		return ret, err
 	}
+	return nil, err
+}
+
+// fetchCluster fetch namespace config of cluster
+func (c *Client) fetchCluster(ctx context.Context, cluster, namesapce, releaseKey string) (*result, error) {
+	url := configURL(c.conf, cluster, namesapce, releaseKey)
 	var result result
-	if err := json.Unmarshal(bts, &result); err != nil {
+	ok, err := c.requester.request(ctx, url, &result)
+	if err != nil || !ok {
 		return nil, err
 	}
+	if result.Cluster == "" {
+		result.Cluster = cluster
+	}
 
-	return c.handleResult(&result), nil
+	return &result, nil
 }
 
-// deliveryChangeEvent push change to subscriber
+// deliveryChangeEvent push change to subscribers, never blocks
 func (c *Client) deliveryChangeEvent(change *ChangeEvent) {
-	if c.updateChan == nil {
-		return
+	c.dispatcher.publish(change)
+}
+
+// decrypt value if it's encrypted, cache and backup file always keep the ciphertext
+func (c *Client) decrypt(value string) (string, error) {
+	c.decryptorLock.RLock()
+	decryptor := c.decryptor
+	c.decryptorLock.RUnlock()
+
+	if decryptor == nil || !decryptor.Match(value) {
+		return value, nil
 	}
-	select {
-	case <-c.ctx.Done():
-	case c.updateChan <- change:
+	return decryptor.Decrypt(value)
+}
+
+// lookup raw value of key in namespace from local cache
+func (c *Client) lookup(namespace, key string) (string, bool) {
+	cache, ok := c.caches.getCache(namespace)
+	if !ok {
+		return "", false
+	}
+	return cache.get(key)
+}
+
+// newInterpolator create interpolator reading raw values with lookup
+func (c *Client) newInterpolator(lookup lookupFunc) *interpolator {
+	return &interpolator{
+		lookup:      lookup,
+		decrypt:     c.decrypt,
+		placeholder: c.conf.EnablePlaceholder,
 	}
 }
 
 // handleResult generate changes from query result, and update local cache
-func (c *Client) handleResult(result *result) *ChangeEvent {
-	var ret = ChangeEvent{
-		Namespace: result.NamespaceName,
-		Changes:   map[string]*Change{},
+func (c *Client) handleResult(result *result) []*ChangeEvent {
+	var changes = map[string]*Change{}
+	var meta = &ChangeEvent{
+		Namespace:      result.NamespaceName,
+		AppID:          result.AppID,
+		Cluster:        result.Cluster,
+		OldReleaseKey:  c.GetReleaseKey(result.NamespaceName),
+		ReleaseKey:     result.ReleaseKey,
+		NotificationID: defaultNotificationID,
+		ReceivedAt:     time.Now(),
+		Source:         SourceRemote,
+	}
+	if meta.AppID == "" {
+		meta.AppID = c.conf.AppID
+	}
+	if meta.Cluster == "" {
+		meta.Cluster = c.conf.Cluster
 	}
 
 	cache := c.mustGetCache(result.NamespaceName)
@@ -198,7 +568,7 @@ func (c *Client) handleResult(result *result) *ChangeEvent {
 	for k, v := range kv {
 		if _, ok := result.Configurations[k]; !ok {
 			cache.delete(k)
-			ret.Changes[k] = makeDeleteChange(k, v)
+			changes[k] = makeDeleteChange(k, v)
 		}
 	}
 
@@ -206,24 +576,117 @@ func (c *Client) handleResult(result *result) *ChangeEvent {
 		cache.set(k, v)
 		old, ok := kv[k]
 		if !ok {
-			ret.Changes[k] = makeAddChange(k, v)
+			changes[k] = makeAddChange(k, v)
 			continue
 		}
 		if old != v {
-			ret.Changes[k] = makeModifyChange(k, old, v)
+			changes[k] = makeModifyChange(k, old, v)
 		}
 	}
 
 	c.setReleaseKey(result.NamespaceName, result.ReleaseKey)
+	c.clusterRepo.set(result.NamespaceName, meta.Cluster)
 
 	// dump caches to file
 	c.dump(c.getDumpFileName())
 
-	if len(ret.Changes) == 0 {
+	if len(changes) == 0 {
 		return nil
 	}
 
-	return &ret
+	return c.makeChangeEvents(meta, kv, changes)
+}
+
+// makeChangeEvents resolve raw changes of namespace to plaintext, and add derived
+// changes of keys referencing changed keys by placeholders. old is the raw kv of
+// namespace before changes, all events share release metadata of meta.
+func (c *Client) makeChangeEvents(meta *ChangeEvent, old map[string]string, changes map[string]*Change) []*ChangeEvent {
+	namespace := meta.Namespace
+	newEvent := func(ns string) *ChangeEvent {
+		event := *meta
+		event.Namespace = ns
+		event.Changes = map[string]*Change{}
+		return &event
+	}
+
+	oldInterpolator := c.newInterpolator(func(ns, key string) (string, bool) {
+		if ns == namespace {
+			val, ok := old[key]
+			return val, ok
+		}
+		return c.lookup(ns, key)
+	})
+	newInterpolator := c.newInterpolator(c.lookup)
+
+	var events = map[string]*ChangeEvent{
+		namespace: newEvent(namespace),
+	}
+
+	// raw values unresolved are never exposed, they may be ciphertext
+	for key, change := range changes {
+		oldVal, _, err := oldInterpolator.resolve(namespace, key)
+		if err != nil {
+			log.Printf("[apollo] err resolve old value of %s of %s: %v", key, namespace, err)
+			oldVal, change.Err = "", err
+		}
+		newVal, _, err := newInterpolator.resolve(namespace, key)
+		if err != nil {
+			log.Printf("[apollo] err resolve %s of %s: %v", key, namespace, err)
+			newVal, change.Err = "", err
+		}
+		change.OldValue, change.NewValue = oldVal, newVal
+		events[namespace].Changes[key] = change
+	}
+
+	if c.conf.EnablePlaceholder {
+		for _, ns := range c.caches.namespaces() {
+			cache, _ := c.caches.getCache(ns)
+			for key, raw := range cache.dump() {
+				if !hasPlaceholder(raw) {
+					continue
+				}
+				if _, ok := changes[key]; ok && ns == namespace {
+					continue
+				}
+
+				oldVal, _, oldErr := oldInterpolator.resolve(ns, key)
+				newVal, _, newErr := newInterpolator.resolve(ns, key)
+				if newErr != nil {
+					log.Printf("[apollo] err resolve %s of %s: %v", key, ns, newErr)
+					continue
+				}
+				if oldErr == nil && oldVal == newVal {
+					continue
+				}
+				if oldErr != nil {
+					oldVal = ""
+				}
+
+				event, ok := events[ns]
+				if !ok {
+					event = newEvent(ns)
+					events[ns] = event
+				}
+				change := makeModifyChange(key, oldVal, newVal)
+				change.Derived = true
+				change.Err = oldErr
+				event.Changes[key] = change
+			}
+		}
+	}
+
+	// event of the updated namespace goes first, then derived ones sorted by namespace
+	ret := []*ChangeEvent{events[namespace]}
+	delete(events, namespace)
+	derived := make([]string, 0, len(events))
+	for ns := range events {
+		derived = append(derived, ns)
+	}
+	sort.Strings(derived)
+	for _, ns := range derived {
+		ret = append(ret, events[ns])
+	}
+	return ret
 }
 
 func (c *Client) getDumpFileName() string {
@@ -238,6 +701,13 @@ func (c *Client) GetReleaseKey(namespace string) string {
 	return releaseKey
 }
 
+// GetCluster return cluster which actually served namespace, it differs from
+// Conf.Cluster if namespace is served by a fallback cluster
+func (c *Client) GetCluster(namespace string) string {
+	cluster, _ := c.clusterRepo.get(namespace)
+	return cluster
+}
+
 func (c *Client) setReleaseKey(namespace, releaseKey string) {
 	c.releaseKeyRepo.set(namespace, releaseKey)
 }
@@ -247,7 +717,7 @@ func (c *Client) autoCreateCacheDir() error {
 	fs, err := os.Stat(c.conf.CacheDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return os.MkdirAll(c.conf.CacheDir, os.ModePerm)
+			return os.MkdirAll(c.conf.CacheDir, 0700)
 		}
 
 		return err
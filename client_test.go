@@ -0,0 +1,236 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientEventMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir})
+	client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"key": "1"},
+		ReleaseKey:     "release-1",
+	})
+	events := client.handleResult(&result{
+		AppID:          "SampleApp",
+		Cluster:        "SHAJQ",
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"key": "2"},
+		ReleaseKey:     "release-2",
+	})
+	assert.Len(t, events, 1)
+	event := events[0]
+	assert.Equal(t, "SampleApp", event.AppID)
+	assert.Equal(t, "SHAJQ", event.Cluster)
+	assert.Equal(t, "release-1", event.OldReleaseKey)
+	assert.Equal(t, "release-2", event.ReleaseKey)
+	assert.Equal(t, defaultNotificationID, event.NotificationID)
+	assert.Equal(t, SourceRemote, event.Source)
+	assert.False(t, event.ReceivedAt.IsZero())
+
+	// load backup into a new client
+	restore := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir})
+	sub := restore.Subscribe()
+	defer sub.Close()
+	assert.Nil(t, restore.loadLocal(client.getDumpFileName()))
+	event = <-sub.Events()
+	assert.Equal(t, SourceBackup, event.Source)
+	assert.Equal(t, "default", event.Cluster)
+	assert.Equal(t, makeAddChange("key", "2"), event.Changes["key"])
+}
+
+func TestClientSubscribeWithSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir})
+	client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"key": "1", "other": "2"},
+		ReleaseKey:     "release-1",
+	})
+	client.publish(client.handleResult(&result{
+		NamespaceName:  "client.json",
+		Configurations: map[string]string{"content": "{}"},
+		ReleaseKey:     "release-1",
+	}))
+
+	sub := client.Subscribe(WithSnapshot(), WithBuffer(8))
+	defer sub.Close()
+	client.publish(client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"key": "2", "other": "2"},
+		ReleaseKey:     "release-2",
+	}))
+
+	var events []*ChangeEvent
+	for i := 0; i < 3; i++ {
+		events = append(events, <-sub.Events())
+	}
+	assert.Equal(t, "application", events[0].Namespace)
+	assert.Equal(t, SourceSnapshot, events[0].Source)
+	assert.Equal(t, "release-1", events[0].ReleaseKey)
+	assert.Equal(t, map[string]*Change{
+		"key":   makeAddChange("key", "1"),
+		"other": makeAddChange("other", "2"),
+	}, events[0].Changes)
+	assert.Equal(t, "client.json", events[1].Namespace)
+	assert.Equal(t, SourceSnapshot, events[1].Source)
+	assert.Equal(t, SourceRemote, events[2].Source)
+	assert.Equal(t, makeModifyChange("key", "1", "2"), events[2].Changes["key"])
+	assert.True(t, events[0].Sequence < events[1].Sequence)
+	assert.True(t, events[1].Sequence < events[2].Sequence)
+}
+
+func TestClientUnsubscribeFromNamespaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{
+		AppID:          "SampleApp",
+		Cluster:        "default",
+		CacheDir:       dir,
+		NameSpaceNames: []string{defaultNamespace, "client.json"},
+	})
+	client.handleResult(&result{NamespaceName: defaultNamespace, Configurations: map[string]string{"key": "1"}})
+	client.handleResult(&result{
+		NamespaceName:  "client.json",
+		Configurations: map[string]string{"content": "{}"},
+		ReleaseKey:     "release-1",
+	})
+
+	sub := client.Subscribe()
+	defer sub.Close()
+	assert.Nil(t, client.UnsubscribeFromNamespaces("client.json", "null"))
+
+	event := <-sub.Events()
+	assert.Equal(t, "client.json", event.Namespace)
+	assert.Equal(t, SourceUnsubscribe, event.Source)
+	assert.Equal(t, "release-1", event.OldReleaseKey)
+	assert.Equal(t, map[string]*Change{"content": makeDeleteChange("content", "{}")}, event.Changes)
+
+	assert.Nil(t, client.GetAllKeys("client.json"))
+	assert.Equal(t, "", client.GetReleaseKey("client.json"))
+	_, ok := client.longPoller.(*longPoller).notifications.getNotificationID("client.json")
+	assert.False(t, ok)
+
+	restore := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir})
+	assert.Nil(t, restore.loadLocal(client.getDumpFileName()))
+	assert.Equal(t, []string{defaultNamespace}, restore.caches.namespaces())
+
+	// unsubscribe again is a no-op
+	assert.Nil(t, client.UnsubscribeFromNamespaces("client.json"))
+
+	// fetch in flight when unsubscribed doesn't recreate the namespace
+	client.requester = requesterFunc(func(ctx context.Context, url string) ([]byte, error) {
+		if strings.Contains(url, "/configfiles/") {
+			return json.Marshal(map[string]string{"content": "{}"})
+		}
+		return json.Marshal(&result{NamespaceName: "client.json", Configurations: map[string]string{"content": "{}"}})
+	})
+	assert.Nil(t, client.handleNamespaceUpdate(context.Background(), &notification{NamespaceName: "client.json", NotificationID: 2}))
+	assert.Nil(t, client.refreshNamespace(context.Background(), "client.json"))
+	_, ok = client.caches.getCache("client.json")
+	assert.False(t, ok)
+	_, ok = client.longPoller.(*longPoller).notifications.getNotificationID("client.json")
+	assert.False(t, ok)
+}
+
+func TestClientNotModified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	serv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/notifications/v2" {
+			json.NewEncoder(rw).Encode([]*notification{{NamespaceName: defaultNamespace, NotificationID: 2}})
+			return
+		}
+		// release key sent by client is the latest
+		if req.FormValue("releaseKey") == "release-1" {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(rw).Encode(&result{NamespaceName: defaultNamespace, Configurations: map[string]string{"key": "2"}, ReleaseKey: "release-2"})
+	}))
+	defer serv.Close()
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", NameSpaceNames: []string{defaultNamespace}, CacheDir: dir, MetaAddr: serv.URL})
+	client.handleResult(&result{NamespaceName: defaultNamespace, Configurations: map[string]string{"key": "1"}, ReleaseKey: "release-1"})
+
+	// 304 of configs is not an error, notification id advances so it's not polled again
+	assert.Nil(t, client.longPoller.(*longPoller).pumpUpdates(context.Background()))
+	assert.Equal(t, "1", client.GetStringValue("key", ""))
+	id, _ := client.longPoller.(*longPoller).notifications.getNotificationID(defaultNamespace)
+	assert.Equal(t, 2, id)
+}
+
+func TestClientRestartLatency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// like Apollo, a poll is held until timeout if client has the latest notification
+	serv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/notifications/v2" {
+			var notifications []*notification
+			json.Unmarshal([]byte(req.FormValue("notifications")), &notifications)
+			if len(notifications) == 1 && notifications[0].NotificationID == 1 {
+				select {
+				case <-req.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			json.NewEncoder(rw).Encode([]*notification{{NamespaceName: defaultNamespace, NotificationID: 1}})
+			return
+		}
+		if req.FormValue("releaseKey") == "release-1" {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(rw).Encode(&result{NamespaceName: defaultNamespace, Configurations: map[string]string{"key": "1"}, ReleaseKey: "release-1"})
+	}))
+	defer serv.Close()
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", NameSpaceNames: []string{defaultNamespace}, CacheDir: dir, MetaAddr: serv.URL})
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		assert.Nil(t, client.Start())
+		assert.True(t, time.Since(start) < time.Second, "start %d took %v", i, time.Since(start))
+		assert.Equal(t, "1", client.GetStringValue("key", ""))
+		assert.Nil(t, client.Stop(context.Background()))
+	}
+}
+
+func TestClientAutoCreateCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cacheDir := filepath.Join(dir, "cache")
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: cacheDir})
+	assert.Nil(t, client.autoCreateCacheDir())
+
+	f, err := os.Stat(cacheDir)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), f.Mode().Perm())
+}
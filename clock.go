@@ -0,0 +1,30 @@
+package apollo
+
+import "time"
+
+// clock abstract time, so polling can be driven by a fake clock in tests
+type clock interface {
+	NewTimer(d time.Duration) timer
+}
+
+// timer is what clock.NewTimer return, like *time.Timer
+type timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is clock of package time
+type realClock struct{}
+
+func (realClock) NewTimer(d time.Duration) timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
@@ -0,0 +1,88 @@
+package apollo
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeClock is a clock moved by Advance
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	armed  chan struct{}
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), armed: make(chan struct{}, 64)}
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), deadline: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	c.signal()
+	return t
+}
+
+// Advance move clock forward, fire timers due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.deadline.After(c.now) {
+			t.active = false
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+func (c *fakeClock) signal() {
+	select {
+	case c.armed <- struct{}{}:
+	default:
+	}
+}
+
+// waitTimer block until a timer is created or reset
+func (c *fakeClock) waitTimer() {
+	<-c.armed
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	active := t.active
+	t.active = true
+	t.deadline = t.clock.now.Add(d)
+	t.clock.signal()
+	return active
+}
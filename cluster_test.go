@@ -0,0 +1,69 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfClusters(t *testing.T) {
+	assert.Equal(t, []string{"default"}, (&Conf{}).clusters())
+	assert.Equal(t, []string{"default"}, (&Conf{Cluster: "default", IDC: "default"}).clusters())
+	assert.Equal(t, []string{"SHAOY", "SHAJQ", "default"}, (&Conf{Cluster: "SHAOY", IDC: "SHAJQ"}).clusters())
+}
+
+func TestClientClusterFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// namespace -> clusters which have it
+	served := map[string][]string{
+		defaultNamespace: {"SHAOY", "SHAJQ", "default"},
+		"idc.json":       {"SHAJQ", "default"},
+		"common":         {"default"},
+	}
+	var lock sync.Mutex
+	var requested []string
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "SHAOY", IDC: "SHAJQ", CacheDir: dir})
+	client.requester = requesterFunc(func(ctx context.Context, target string) ([]byte, error) {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		assert.Equal(t, "SHAJQ", u.Query().Get("dataCenter"))
+		strs := strings.Split(u.Path, "/")
+		cluster, namespace := strs[3], strs[4]
+
+		lock.Lock()
+		requested = append(requested, cluster+"/"+namespace)
+		lock.Unlock()
+
+		for _, c := range served[namespace] {
+			if c == cluster {
+				return json.Marshal(&result{NamespaceName: namespace, Configurations: map[string]string{"cluster": cluster}})
+			}
+		}
+		return nil, ErrorStatusNotFound
+	})
+
+	for namespace, clusters := range served {
+		ret, err := client.fetch(context.Background(), namespace)
+		assert.Nil(t, err)
+		client.handleResult(ret)
+		assert.Equal(t, clusters[0], client.GetCluster(namespace))
+		assert.Equal(t, clusters[0], client.GetStringValueWithNameSpace(namespace, "cluster", ""))
+	}
+	assert.Len(t, requested, 6)
+
+	_, err = client.fetch(context.Background(), "missing")
+	assert.Equal(t, ErrorStatusNotFound, err)
+	assert.Equal(t, "", client.GetCluster("missing"))
+}
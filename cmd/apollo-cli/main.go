@@ -0,0 +1,450 @@
+// Command apollo-cli inspect and diff Apollo configuration.
+//
+//	apollo-cli get [flags] <namespace> <key>
+//	apollo-cli keys [flags] <namespace>
+//	apollo-cli dump [flags] <namespace>
+//	apollo-cli watch [flags] <namespace>...
+//	apollo-cli diff [flags] [-file name | -with-cluster cluster] <namespace>
+//	apollo-cli decode-cache [-keys key1,key2] <file>
+//
+// Client settings are read from -conf file, flags -app.id, -apollo.meta,
+// -apollo.cluster, -idc, -env, and env variables APP_ID, APOLLO_META and IDC.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+)
+
+const usage = `usage: apollo-cli <command> [flags] [args]
+
+commands:
+  get           print value of a key in namespace
+  keys          print keys of namespace
+  dump          print namespace as json
+  watch         print change events of namespaces as json lines
+  diff          compare namespace with a json file or another cluster
+  decode-cache  print backup file in cache dir as json
+
+run apollo-cli <command> -h for flags of command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	os.Exit(run(os.Args[1], os.Args[2:], os.Stdout))
+}
+
+// run command with args, return exit code
+func run(command string, args []string, out io.Writer) int {
+	var err error
+	switch command {
+	case "get":
+		err = get(args, out)
+	case "keys":
+		err = keys(args, out)
+	case "dump":
+		err = dump(args, out)
+	case "watch":
+		err = watch(args, out)
+	case "diff":
+		var changed bool
+		changed, err = diff(args, out)
+		if err == nil && changed {
+			return 1
+		}
+	case "decode-cache":
+		err = decodeCache(args, out)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(out, usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		return 2
+	}
+
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "apollo-cli:", err)
+		return 2
+	}
+	return 0
+}
+
+// clientFlags are flags to create a client
+var errCacheDirFlag = errors.New("apollo-cli doesn't support -apollo.cacheDir, backup is written to a temp dir")
+
+type clientFlags struct {
+	fs      *flag.FlagSet
+	file    string
+	conf    *apollo.Conf
+	timeout time.Duration
+}
+
+func newClientFlags(name string) *clientFlags {
+	f := &clientFlags{
+		fs: flag.NewFlagSet(name, flag.ContinueOnError),
+		conf: &apollo.Conf{
+			AppID:    os.Getenv("APP_ID"),
+			MetaAddr: os.Getenv("APOLLO_META"),
+			IDC:      os.Getenv("IDC"),
+		},
+	}
+	f.fs.StringVar(&f.file, "conf", "", "conf file, properties, yaml or json")
+	f.fs.DurationVar(&f.timeout, "timeout", 10*time.Second, "timeout of loading config, and of stopping the client")
+	f.conf.BindFlags(f.fs)
+	return f
+}
+
+// parse args, return positional args
+func (f *clientFlags) parse(args []string, min int) ([]string, error) {
+	if err := f.fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if f.fs.NArg() < min {
+		f.fs.Usage()
+		return nil, fmt.Errorf("%s needs %d args, got %d", f.fs.Name(), min, f.fs.NArg())
+	}
+	return f.fs.Args(), nil
+}
+
+// newConf merge conf file and flags, flags take precedence
+func (f *clientFlags) newConf(namespaces ...string) (*apollo.Conf, error) {
+	// backup is always written to a temp dir, see start
+	if f.conf.CacheDir != "" {
+		return nil, errCacheDirFlag
+	}
+	conf := &apollo.Conf{}
+	if f.file != "" {
+		var err error
+		if conf, err = apollo.LoadConf(f.file); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&conf.AppID, f.conf.AppID},
+		{&conf.MetaAddr, f.conf.MetaAddr},
+		{&conf.Cluster, f.conf.Cluster},
+		{&conf.IDC, f.conf.IDC},
+		{&conf.Env, f.conf.Env},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if conf.Cluster == "" {
+		conf.Cluster = "default"
+	}
+	conf.NameSpaceNames = namespaces
+	return conf, conf.Validate()
+}
+
+// start a client for namespaces within timeout, backup is written to a temp dir
+// which is removed by the returned stop func
+func (f *clientFlags) start(conf *apollo.Conf) (*apollo.Client, func(), error) {
+	dir, err := ioutil.TempDir("", "apollo-cli")
+	if err != nil {
+		return nil, nil, err
+	}
+	conf.CacheDir = dir
+
+	client := apollo.NewClient(conf)
+	started := make(chan error, 1)
+	go func() { started <- client.Start() }()
+
+	timer := time.NewTimer(f.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-started:
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, nil, err
+		}
+	case <-timer.C:
+		// Start can't be canceled, clean up once it returns
+		go func() {
+			if err := <-started; err == nil {
+				client.Stop(context.Background())
+			}
+			os.RemoveAll(dir)
+		}()
+		return nil, nil, fmt.Errorf("loading config timed out after %v", f.timeout)
+	}
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+		defer cancel()
+		client.Stop(ctx)
+		os.RemoveAll(dir)
+	}
+	return client, stop, nil
+}
+
+// load namespace through a client
+func (f *clientFlags) load(conf *apollo.Conf, namespace string) (map[string]string, error) {
+	client, stop, err := f.start(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	return values(client, namespace), nil
+}
+
+// loadCluster load namespace released in cluster, it fails instead of falling
+// back to cluster of data center or default
+func (f *clientFlags) loadCluster(conf *apollo.Conf, namespace, cluster string) (map[string]string, error) {
+	conf.Cluster = cluster
+	client, stop, err := f.start(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	if client.GetCluster(namespace) != cluster {
+		return nil, fmt.Errorf("namespace %s is not released in cluster %s", namespace, cluster)
+	}
+	return values(client, namespace), nil
+}
+
+func values(client *apollo.Client, namespace string) map[string]string {
+	kv := map[string]string{}
+	for _, key := range client.GetAllKeys(namespace) {
+		kv[key] = client.GetStringValueWithNameSpace(namespace, key, "")
+	}
+	return kv
+}
+
+func get(args []string, out io.Writer) error {
+	f := newClientFlags("get")
+	args, err := f.parse(args, 2)
+	if err != nil {
+		return err
+	}
+	conf, err := f.newConf(args[0])
+	if err != nil {
+		return err
+	}
+	kv, err := f.load(conf, args[0])
+	if err != nil {
+		return err
+	}
+	value, ok := kv[args[1]]
+	if !ok {
+		return fmt.Errorf("key %s not found in %s", args[1], args[0])
+	}
+	fmt.Fprintln(out, value)
+	return nil
+}
+
+func keys(args []string, out io.Writer) error {
+	f := newClientFlags("keys")
+	args, err := f.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	conf, err := f.newConf(args[0])
+	if err != nil {
+		return err
+	}
+	kv, err := f.load(conf, args[0])
+	if err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(kv) {
+		fmt.Fprintln(out, key)
+	}
+	return nil
+}
+
+func dump(args []string, out io.Writer) error {
+	f := newClientFlags("dump")
+	args, err := f.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	conf, err := f.newConf(args[0])
+	if err != nil {
+		return err
+	}
+	kv, err := f.load(conf, args[0])
+	if err != nil {
+		return err
+	}
+	return writeJSON(out, kv)
+}
+
+func watch(args []string, out io.Writer) error {
+	f := newClientFlags("watch")
+	args, err := f.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	conf, err := f.newConf(args...)
+	if err != nil {
+		return err
+	}
+	client, stop, err := f.start(conf)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	sub := client.Subscribe(apollo.WithSnapshot())
+	defer sub.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	encoder := json.NewEncoder(out)
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func diff(args []string, out io.Writer) (bool, error) {
+	f := newClientFlags("diff")
+	var file, cluster string
+	f.fs.StringVar(&file, "file", "", "json file to compare with, like output of dump")
+	f.fs.StringVar(&cluster, "with-cluster", "", "cluster to compare with")
+	args, err := f.parse(args, 1)
+	if err != nil {
+		return false, err
+	}
+	if (file == "") == (cluster == "") {
+		return false, fmt.Errorf("diff needs one of -file and -with-cluster")
+	}
+
+	namespace := args[0]
+	conf, err := f.newConf(namespace)
+	if err != nil {
+		return false, err
+	}
+	live, err := f.load(conf, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	var other map[string]string
+	if file != "" {
+		bts, err := ioutil.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(bts, &other); err != nil {
+			return false, fmt.Errorf("parse %s: %v", file, err)
+		}
+	} else {
+		otherConf, err := f.newConf(namespace)
+		if err != nil {
+			return false, err
+		}
+		if other, err = f.loadCluster(otherConf, namespace, cluster); err != nil {
+			return false, err
+		}
+	}
+
+	lines := diffLines(other, live)
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+	return len(lines) > 0, nil
+}
+
+// diffLines describe changes from old to new, sorted by key:
+// "+ key=value" for added, "- key=value" for deleted, "~ key=old -> new" for modified
+func diffLines(old, new map[string]string) []string {
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, k := range sorted {
+		o, inOld := old[k]
+		n, inNew := new[k]
+		switch {
+		case !inOld:
+			lines = append(lines, fmt.Sprintf("+ %s=%s", k, n))
+		case !inNew:
+			lines = append(lines, fmt.Sprintf("- %s=%s", k, o))
+		case o != n:
+			lines = append(lines, fmt.Sprintf("~ %s=%s -> %s", k, o, n))
+		}
+	}
+	return lines
+}
+
+func decodeCache(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("decode-cache", flag.ContinueOnError)
+	keys := fs.String("keys", "", "comma separated base64 keys of encrypted backup, default env APOLLO_BACKUP_KEYS")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("decode-cache needs the backup file")
+	}
+
+	var backupKeys []string
+	if *keys != "" {
+		backupKeys = strings.Split(*keys, ",")
+	}
+	dumps, err := apollo.ReadBackup(fs.Arg(0), backupKeys...)
+	if err != nil {
+		return err
+	}
+	return writeJSON(out, dumps)
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func sortedKeys(kv map[string]string) []string {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
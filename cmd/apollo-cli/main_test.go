@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+	"github.com/stretchr/testify/assert"
+)
+
+// newServer serve configs of cluster default and SHAJQ, other clusters are not found
+func newServer() *httptest.Server {
+	configs := map[string]map[string]string{
+		"default": {"timeout": "100", "retry": "3"},
+		"SHAJQ":   {"timeout": "200", "host": "jq"},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/notifications/") {
+			rw.Write([]byte(`[{"namespaceName":"application","notificationId":1}]`))
+			return
+		}
+		strs := strings.Split(req.URL.Path, "/")
+		if _, ok := configs[strs[3]]; !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		bts, _ := json.Marshal(map[string]interface{}{
+			"namespaceName":  strs[4],
+			"configurations": configs[strs[3]],
+			"releaseKey":     "release-1",
+		})
+		rw.Write(bts)
+	}))
+}
+
+func TestCommands(t *testing.T) {
+	serv := newServer()
+	defer serv.Close()
+	flags := []string{"-app.id", "SampleApp", "-apollo.meta", serv.URL}
+
+	var out bytes.Buffer
+	assert.Equal(t, 0, run("get", append(flags, "application", "timeout"), &out))
+	assert.Equal(t, "100\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 0, run("keys", append(flags, "application"), &out))
+	assert.Equal(t, "retry\ntimeout\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 0, run("dump", append(flags, "application"), &out))
+	var kv map[string]string
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &kv))
+	assert.Equal(t, map[string]string{"timeout": "100", "retry": "3"}, kv)
+
+	dir, err := ioutil.TempDir("", "apollo-cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "application.json")
+	assert.Nil(t, ioutil.WriteFile(file, out.Bytes(), 0644))
+
+	out.Reset()
+	assert.Equal(t, 0, run("diff", append(flags, "-file", file, "application"), &out))
+	assert.Equal(t, "", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, run("diff", append(flags, "-with-cluster", "SHAJQ", "application"), &out))
+	assert.Equal(t, "- host=jq\n+ retry=3\n~ timeout=200 -> 100\n", out.String())
+
+	// namespace not released in the cluster isn't compared with default cluster
+	out.Reset()
+	_, err = diff(append(flags, "-with-cluster", "SHAOY", "application"), &out)
+	assert.EqualError(t, err, "namespace application is not released in cluster SHAOY")
+	assert.Equal(t, 2, run("diff", append(flags, "-with-cluster", "SHAOY", "application"), &out))
+
+	err = keys(append(flags, "-apollo.cacheDir", dir, "application"), &out)
+	assert.Equal(t, errCacheDirFlag, err)
+
+	assert.Equal(t, 2, run("get", []string{"application", "timeout"}, &out))
+	assert.Equal(t, 2, run("unknown", nil, &out))
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	serv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer serv.Close()
+	defer close(release)
+
+	start := time.Now()
+	err := get([]string{"-app.id", "SampleApp", "-apollo.meta", serv.URL, "-timeout", "50ms", "application", "timeout"}, ioutil.Discard)
+	assert.EqualError(t, err, "loading config timed out after 50ms")
+	assert.True(t, time.Since(start) < time.Second, "took %v", time.Since(start))
+}
+
+func TestDecodeCache(t *testing.T) {
+	serv := newServer()
+	defer serv.Close()
+
+	dir, err := ioutil.TempDir("", "apollo-cli")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := apollo.NewClient(&apollo.Conf{
+		AppID:          "SampleApp",
+		Cluster:        "default",
+		NameSpaceNames: []string{"application"},
+		CacheDir:       dir,
+		MetaAddr:       serv.URL,
+	})
+	assert.Nil(t, client.Start())
+	assert.Nil(t, client.Stop(context.Background()))
+
+	var out bytes.Buffer
+	assert.Equal(t, 0, run("decode-cache", []string{filepath.Join(dir, ".SampleApp_default")}, &out))
+	var dumps map[string]map[string]string
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &dumps))
+	assert.Equal(t, "100", dumps["application"]["timeout"])
+}
+
+func TestDiffLines(t *testing.T) {
+	assert.Nil(t, diffLines(map[string]string{"a": "1"}, map[string]string{"a": "1"}))
+	assert.Equal(t, []string{"- a=1", "+ b=2"}, diffLines(map[string]string{"a": "1"}, map[string]string{"b": "2"}))
+}
@@ -37,29 +37,43 @@ func httpurl(ipOrAddr string) string {
 }
 
 func notificationURL(conf *Conf, notifications string) string {
-	var addr = conf.IP
-	if conf.MetaAddr != "" {
-		addr = conf.MetaAddr
-	}
-	return fmt.Sprintf("%s/notifications/v2?appId=%s&cluster=%s&notifications=%s",
+	var addr = conf.serverAddr()
+	return fmt.Sprintf("%s/notifications/v2?appId=%s&cluster=%s&notifications=%s%s",
 		httpurl(addr),
 		url.QueryEscape(conf.AppID),
 		url.QueryEscape(conf.Cluster),
-		url.QueryEscape(notifications))
+		url.QueryEscape(notifications),
+		dataCenterQuery(conf))
 }
 
-func configURL(conf *Conf, namespace, releaseKey string) string {
-	var addr = conf.IP
-	if conf.MetaAddr != "" {
-		addr = conf.MetaAddr
-	}
-	return fmt.Sprintf("%s/configs/%s/%s/%s?releaseKey=%s&ip=%s",
+func configURL(conf *Conf, cluster, namespace, releaseKey string) string {
+	var addr = conf.serverAddr()
+	return fmt.Sprintf("%s/configs/%s/%s/%s?releaseKey=%s&ip=%s%s",
 		httpurl(addr),
 		url.QueryEscape(conf.AppID),
-		url.QueryEscape(conf.Cluster),
+		url.QueryEscape(cluster),
 		url.QueryEscape(namespace),
 		releaseKey,
-		getLocalIP())
+		getLocalIP(),
+		dataCenterQuery(conf))
+}
+
+func configFilesURL(conf *Conf, cluster, namespace string) string {
+	var addr = conf.serverAddr()
+	return fmt.Sprintf("%s/configfiles/json/%s/%s/%s?ip=%s%s",
+		httpurl(addr),
+		url.QueryEscape(conf.AppID),
+		url.QueryEscape(cluster),
+		url.QueryEscape(namespace),
+		getLocalIP(),
+		dataCenterQuery(conf))
+}
+
+func dataCenterQuery(conf *Conf) string {
+	if conf.IDC == "" {
+		return ""
+	}
+	return "&dataCenter=" + url.QueryEscape(conf.IDC)
 }
 
 func copyStruct(obj interface{}) interface{} {
@@ -35,13 +35,27 @@ func TestConfigURL(t *testing.T) {
 			IP:       "127.0.0.1:8080",
 			AppID:    "SampleApp",
 			Cluster:  "default",
-		}, "application", "")
+		}, "default", "application", "")
 	_, err := url.Parse(target)
 	if err != nil {
 		t.Error(err)
 	}
 }
 
+func TestConfigFilesURL(t *testing.T) {
+	target := configFilesURL(
+		&Conf{
+			IP:      "127.0.0.1:8080",
+			AppID:   "SampleApp",
+			Cluster: "default",
+		}, "default", "client.json")
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Error(err)
+	}
+	assert.Equal(t, "/configfiles/json/SampleApp/default/client.json", u.Path)
+}
+
 func TestCopyStruct(t *testing.T) {
 	type st struct {
 		Foo string
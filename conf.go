@@ -1,11 +1,39 @@
 package apollo
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 )
 
+var (
+	// ErrNoAppID returned by Conf.Validate when AppID is missing
+	ErrNoAppID = errors.New("conf: app id is missing, set app.id or env APP_ID")
+	// ErrNoAddress returned by Conf.Validate when none of IP, MetaAddr and MetaServers is set
+	ErrNoAddress = errors.New("conf: config server address is missing, set apollo.meta or env APOLLO_META")
+	// ErrUnknownEnv returned by Conf.Validate when MetaServers has no address for active env
+	ErrUnknownEnv = errors.New("conf: no meta server address for active env")
+	// ErrNoConfProperty returned when a properties file has none of the conf keys, like app.id
+	ErrNoConfProperty = errors.New("conf: no apollo settings in properties file")
+)
+
+// serverPropertiesFile is where env of the server is configured
+var serverPropertiesFile = "/opt/settings/server.properties"
+
+func init() {
+	if runtime.GOOS == "windows" {
+		serverPropertiesFile = "C:/opt/settings/server.properties"
+	}
+}
+
 // Conf ...
 type Conf struct {
 	AppID          string   `json:"appId,omitempty"`
@@ -14,21 +42,365 @@ type Conf struct {
 	CacheDir       string   `json:"cacheDir,omitempty"`
 	IP             string   `json:"ip,omitempty"`
 	MetaAddr       string   `json:"meta_addr"`
+	// IDC is data center of the client, if empty it's read from /opt/settings/server.properties.
+	// Namespace not found in Cluster is fetched from cluster of IDC, then default cluster.
+	IDC string `json:"idc,omitempty"`
+
+	// MetaServers map env name like DEV, FAT, UAT and PRO to meta address, the
+	// one of active env is used if MetaAddr is empty
+	MetaServers map[string]string `json:"metaServers,omitempty"`
+	// Env is the active env, if empty it's read from env variable ENV or env,
+	// then from /opt/settings/server.properties
+	Env string `json:"env,omitempty"`
+
+	// DecryptKeyFile is a file contains base64 encoded AES key for ENC(...) values
+	DecryptKeyFile string `json:"decryptKeyFile,omitempty"`
+	// DecryptKeyEnv is an env variable contains base64 encoded AES key for ENC(...) values
+	DecryptKeyEnv string `json:"decryptKeyEnv,omitempty"`
+	// Decryptor decrypt config values, take precedence over DecryptKeyFile and DecryptKeyEnv
+	Decryptor Decryptor `json:"-"`
+
+	// BackupKeys are base64 encoded AES keys to encrypt the backup file in CacheDir.
+	// The first key is used to encrypt, all keys are tried to decrypt.
+	// If empty, keys are read from env APOLLO_BACKUP_KEYS, separated by comma.
+	BackupKeys []string `json:"backupKeys,omitempty"`
+
+	// EnablePlaceholder resolve ${key}, ${namespace:key} and ${env:VAR:-default} in values
+	EnablePlaceholder bool `json:"enablePlaceholder,omitempty"`
+
+	// LazyLoad fetch namespaces not in NameSpaceNames on first read, and subscribe them
+	LazyLoad bool `json:"lazyLoad,omitempty"`
+	// LazyLoadTimeoutMs is timeout of fetching a namespace on first read, in milliseconds
+	LazyLoadTimeoutMs int `json:"lazyLoadTimeoutMs,omitempty"`
+
+	// FetchConcurrency is max namespaces fetched at the same time on preload and update, default 8
+	FetchConcurrency int `json:"fetchConcurrency,omitempty"`
+
+	// EnableRefresh periodically check namespaces via the cached /configfiles endpoint,
+	// as a safety net against missed notifications
+	EnableRefresh bool `json:"enableRefresh,omitempty"`
+	// RefreshIntervalMs is interval of periodic refresh in milliseconds, default 5 minutes
+	RefreshIntervalMs int `json:"refreshIntervalMs,omitempty"`
+
+	// MaxResponseBytes is max decoded size of a response body, default 16MB,
+	// larger responses fail with ErrResponseTooLarge
+	MaxResponseBytes int64 `json:"maxResponseBytes,omitempty"`
 }
 
-// NewConf create Conf from file
+// NewConf create Conf from file, which is Java properties, YAML or JSON detected
+// by extension and content. The file is decoded as is, use LoadConf to apply
+// env variables, defaults and validation.
 func NewConf(name string) (*Conf, error) {
-	f, err := os.Open(name)
+	bts, err := ioutil.ReadFile(name)
 	if err != nil {
 		fmt.Println("err:", err)
 		return nil, err
 	}
-	defer f.Close()
 
 	var ret Conf
-	if err := json.NewDecoder(f).Decode(&ret); err != nil {
+	switch confFormat(name, bts) {
+	case "json":
+		err = json.Unmarshal(bts, &ret)
+	case "yaml":
+		err = unmarshalYAML(bts, &ret)
+	default:
+		err = unmarshalProperties(bts, &ret)
+	}
+	if err != nil {
 		return nil, err
 	}
-
 	return &ret, nil
 }
+
+// LoadConf create Conf from file like NewConf. Env APP_ID, APOLLO_META, IDC and
+// APOLLO_CACHE_DIR override the file, and the result is validated.
+func LoadConf(name string) (*Conf, error) {
+	ret, err := NewConf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.applyEnv()
+	ret.applyDefaults()
+	ret.resolveEnv()
+	if err := ret.Validate(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// confFormat detect format of conf file, JSON content is accepted whatever the extension
+func confFormat(name string, bts []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(bts), []byte("{")) {
+		return "json"
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "properties"
+}
+
+// unmarshalYAML decode YAML with the same keys as JSON
+func unmarshalYAML(bts []byte, c *Conf) error {
+	m, err := parseYAML(bts)
+	if err != nil {
+		return err
+	}
+	if bts, err = json.Marshal(m); err != nil {
+		return err
+	}
+	return json.Unmarshal(bts, c)
+}
+
+// unmarshalProperties decode Java style app.properties, a file of other keys only
+// is not a conf
+func unmarshalProperties(bts []byte, c *Conf) error {
+	props, err := parseProperties(bytes.NewReader(bts))
+	if err != nil {
+		return err
+	}
+	if len(props) > 0 && !hasConfProperty(props) {
+		return ErrNoConfProperty
+	}
+
+	c.AppID = props["app.id"]
+	c.Cluster = props["apollo.cluster"]
+	c.CacheDir = props["apollo.cacheDir"]
+	c.MetaAddr = props["apollo.meta"]
+	c.IDC = props["idc"]
+	c.Env = props["env"]
+	for key, addr := range props {
+		// dev.meta=http://localhost:8080
+		if strings.HasSuffix(key, ".meta") && key != "apollo.meta" {
+			if c.MetaServers == nil {
+				c.MetaServers = map[string]string{}
+			}
+			c.MetaServers[strings.TrimSuffix(key, ".meta")] = addr
+		}
+	}
+	if namespaces := props["apollo.bootstrap.namespaces"]; namespaces != "" {
+		for _, namespace := range strings.Split(namespaces, ",") {
+			if namespace = strings.TrimSpace(namespace); namespace != "" {
+				c.NameSpaceNames = append(c.NameSpaceNames, namespace)
+			}
+		}
+	}
+	return nil
+}
+
+func hasConfProperty(props map[string]string) bool {
+	for key := range props {
+		switch key {
+		case "app.id", "apollo.cluster", "apollo.cacheDir", "apollo.meta", "idc", "env", "apollo.bootstrap.namespaces":
+			return true
+		}
+		if strings.HasSuffix(key, ".meta") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnv override conf with standard env variables
+func (c *Conf) applyEnv() {
+	for env, field := range map[string]*string{
+		envAppID:    &c.AppID,
+		envMeta:     &c.MetaAddr,
+		envIDC:      &c.IDC,
+		envCacheDir: &c.CacheDir,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+}
+
+func (c *Conf) applyDefaults() {
+	if c.Cluster == "" {
+		c.Cluster = defaultCluster
+	}
+	if len(c.NameSpaceNames) == 0 {
+		c.NameSpaceNames = []string{defaultNamespace}
+	}
+}
+
+// resolveEnv find out active env and data center if they are not set
+func (c *Conf) resolveEnv() {
+	if c.IDC == "" {
+		if idc := readServerProperty("idc"); idc != "" {
+			c.IDC = idc
+		}
+	}
+	if c.Env != "" {
+		return
+	}
+	env := os.Getenv(envEnv)
+	if env == "" {
+		env = os.Getenv(strings.ToLower(envEnv))
+	}
+	if env == "" {
+		env = readServerProperty("env")
+	}
+	if env != "" {
+		c.Env = env
+	}
+}
+
+// readServerProperty read key from server properties file, empty if not found
+func readServerProperty(key string) string {
+	f, err := os.Open(serverPropertiesFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	props, err := parseProperties(f)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(props[key])
+}
+
+// metaServer return meta address of active env
+func (c *Conf) metaServer() string {
+	if len(c.MetaServers) == 0 || c.Env == "" {
+		return ""
+	}
+	for env, addr := range c.MetaServers {
+		if strings.EqualFold(env, c.Env) {
+			return addr
+		}
+	}
+	return ""
+}
+
+// clusters return clusters to fetch namespace from in order: the configured
+// cluster, cluster of data center, then default
+func (c *Conf) clusters() []string {
+	var clusters []string
+	for _, cluster := range []string{c.Cluster, c.IDC, defaultCluster} {
+		if cluster == "" {
+			continue
+		}
+		var dup bool
+		for _, added := range clusters {
+			dup = dup || added == cluster
+		}
+		if !dup {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
+// serverAddr return address of config server, MetaAddr take precedence over
+// MetaServers of active env, then IP
+func (c *Conf) serverAddr() string {
+	if c.MetaAddr != "" {
+		return c.MetaAddr
+	}
+	if addr := c.metaServer(); addr != "" {
+		return addr
+	}
+	return c.IP
+}
+
+// BindFlags register flags -app.id, -apollo.meta, -apollo.cluster, -apollo.cacheDir,
+// -idc and -env, which override conf when fs is parsed. Use ParseFlags to parse
+// fs, so the overridden conf is validated again.
+func (c *Conf) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.AppID, "app.id", c.AppID, "apollo app id")
+	fs.StringVar(&c.MetaAddr, "apollo.meta", c.MetaAddr, "apollo meta server address")
+	fs.StringVar(&c.Cluster, "apollo.cluster", c.Cluster, "apollo cluster")
+	fs.StringVar(&c.CacheDir, "apollo.cacheDir", c.CacheDir, "dir of local backup")
+	fs.StringVar(&c.IDC, "idc", c.IDC, "data center")
+	fs.StringVar(&c.Env, "env", c.Env, "active env, like DEV, FAT, UAT or PRO")
+}
+
+// ParseFlags parse args with fs, which has flags registered by BindFlags, then
+// validate the overridden conf
+func (c *Conf) ParseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c.resolveEnv()
+	return c.Validate()
+}
+
+// Validate report missing required settings
+func (c *Conf) Validate() error {
+	if c.AppID == "" {
+		return ErrNoAppID
+	}
+	if c.serverAddr() != "" {
+		return nil
+	}
+	if len(c.MetaServers) > 0 {
+		return ErrUnknownEnv
+	}
+	return ErrNoAddress
+}
+
+// newDecryptor create decryptor from conf, return nil if none configured
+func (c *Conf) newDecryptor() (Decryptor, error) {
+	switch {
+	case c.Decryptor != nil:
+		return c.Decryptor, nil
+	case c.DecryptKeyFile != "":
+		return NewAESDecryptorFromFile(c.DecryptKeyFile)
+	case c.DecryptKeyEnv != "":
+		return NewAESDecryptorFromEnv(c.DecryptKeyEnv)
+	}
+	return nil, nil
+}
+
+// backupKeys decode keys to encrypt backup file
+func (c *Conf) backupKeys() ([][]byte, error) {
+	encoded := c.BackupKeys
+	if len(encoded) == 0 {
+		if env := os.Getenv(envBackupKeys); env != "" {
+			encoded = strings.Split(env, ",")
+		}
+	}
+
+	var keys [][]byte
+	for _, s := range encoded {
+		key, err := decodeKey(s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (c *Conf) lazyLoadTimeout() time.Duration {
+	if c.LazyLoadTimeoutMs > 0 {
+		return time.Duration(c.LazyLoadTimeoutMs) * time.Millisecond
+	}
+	return queryTimeout
+}
+
+func (c *Conf) fetchConcurrency() int {
+	if c.FetchConcurrency > 0 {
+		return c.FetchConcurrency
+	}
+	return defaultFetchConcurrency
+}
+
+func (c *Conf) refreshInterval() time.Duration {
+	if c.RefreshIntervalMs > 0 {
+		return time.Duration(c.RefreshIntervalMs) * time.Millisecond
+	}
+	return refreshInterval
+}
+
+func (c *Conf) maxResponseBytes() int64 {
+	if c.MaxResponseBytes > 0 {
+		return c.MaxResponseBytes
+	}
+	return defaultMaxResponseBytes
+}
@@ -1,6 +1,13 @@
 package apollo
 
-import "testing"
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestNewConf(t *testing.T) {
 	var tcs = []struct {
@@ -27,3 +34,212 @@ func TestNewConf(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadConfFormats(t *testing.T) {
+	for _, name := range []string{"app.properties", "java.properties", "app.yaml"} {
+		conf, err := LoadConf("./testdata/" + name)
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+		assert.Equal(t, "SampleApp", conf.AppID, name)
+		assert.Equal(t, "default", conf.Cluster, name)
+		assert.Equal(t, "/tmp/apollo", conf.CacheDir, name)
+		assert.NotEmpty(t, conf.NameSpaceNames, name)
+	}
+
+	conf, err := LoadConf("./testdata/java.properties")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:8080", conf.MetaAddr)
+	assert.Equal(t, []string{"application", "client.json"}, conf.NameSpaceNames)
+}
+
+func TestLoadConfEnv(t *testing.T) {
+	for env, value := range map[string]string{
+		envAppID:    "EnvApp",
+		envMeta:     "http://meta:8080",
+		envIDC:      "SHAJQ",
+		envCacheDir: "/tmp/env",
+	} {
+		os.Setenv(env, value)
+		defer os.Unsetenv(env)
+	}
+
+	// NewConf decode file as is
+	for _, name := range []string{defaultConfName, "java.properties", "app.yaml"} {
+		conf, err := NewConf("./testdata/" + name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, "SampleApp", conf.AppID, name)
+		assert.Equal(t, "", conf.IDC, name)
+	}
+
+	conf, err := LoadConf("./testdata/java.properties")
+	assert.Nil(t, err)
+	assert.Equal(t, "EnvApp", conf.AppID)
+	assert.Equal(t, "http://meta:8080", conf.MetaAddr)
+	assert.Equal(t, "SHAJQ", conf.IDC)
+	assert.Equal(t, "/tmp/env", conf.CacheDir)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	conf.BindFlags(fs)
+	assert.Nil(t, conf.ParseFlags(fs, []string{"-app.id", "FlagApp", "-apollo.cluster", "SHAOY"}))
+	assert.Equal(t, "FlagApp", conf.AppID)
+	assert.Equal(t, "SHAOY", conf.Cluster)
+	assert.Equal(t, "SHAJQ", conf.IDC)
+
+	// flags are validated too
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	conf.BindFlags(fs)
+	assert.Equal(t, ErrNoAppID, conf.ParseFlags(fs, []string{"-app.id", ""}))
+}
+
+func TestParseYAML(t *testing.T) {
+	m, err := parseYAML([]byte(`
+# comment
+---
+appId: SampleApp  # trailing comment
+cluster: "de#fault"
+namespaceNames: [application, 'client.json']
+metaServers:
+  DEV: http://dev:8080
+  "FAT": http://fat:8080
+backupKeys:
+- a
+-  b
+enableRefresh: true
+refreshIntervalMs: 1000
+idc:
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"appId":             "SampleApp",
+		"cluster":           "de#fault",
+		"namespaceNames":    []interface{}{"application", "client.json"},
+		"metaServers":       map[string]interface{}{"DEV": "http://dev:8080", "FAT": "http://fat:8080"},
+		"backupKeys":        []interface{}{"a", "b"},
+		"enableRefresh":     true,
+		"refreshIntervalMs": int64(1000),
+		"idc":               nil,
+	}, m)
+
+	for bad, msg := range map[string]string{
+		"a: [b":           "unclosed flow sequence",
+		"a: {b: c}":       "flow mapping is not supported",
+		"a: [b, {c: d}]":  "flow mapping is not supported",
+		"a: [[b]]":        "nested flow sequence is not supported",
+		"a: |\n  text":    "block scalar | is not supported",
+		"a: >-\n  text":   "block scalar > is not supported",
+		"a: &x b":         "anchor is not supported",
+		"a: *x":           "alias is not supported",
+		"a: !!str b":      "tag is not supported",
+		"<<: b":           "merge key is not supported",
+		"? a\n: b":        "complex key is not supported",
+		"a:\n- b: c":      "sequence of mappings is not supported",
+		"a:\n- - b":       "sequence of sequences is not supported",
+		"a: b\n  c":       "multi-line plain scalar is not supported",
+		"a: b\n---\nc: d": "multiple documents are not supported",
+		"a":               "expect key: value",
+		"- a":             "yaml is not a mapping",
+	} {
+		_, err := parseYAML([]byte(bad))
+		if assert.NotNil(t, err, bad) {
+			assert.Contains(t, err.Error(), msg, bad)
+		}
+	}
+
+	m, err = parseYAML([]byte("a: ['b, c', \"d\"]\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{"b, c", "d"}}, m)
+
+	conf := &Conf{}
+	assert.Nil(t, unmarshalYAML([]byte("appId: SampleApp\nenableRefresh: true\nrefreshIntervalMs: 1000\n"), conf))
+	assert.Equal(t, &Conf{AppID: "SampleApp", EnableRefresh: true, RefreshIntervalMs: 1000}, conf)
+}
+
+func TestConfValidate(t *testing.T) {
+	assert.Equal(t, ErrNoAppID, (&Conf{IP: "localhost:8080"}).Validate())
+	assert.Equal(t, ErrNoAddress, (&Conf{AppID: "SampleApp"}).Validate())
+	assert.Nil(t, (&Conf{AppID: "SampleApp", MetaAddr: "http://localhost:8080"}).Validate())
+}
+
+func TestConfMetaServers(t *testing.T) {
+	defer func(name string) { serverPropertiesFile = name }(serverPropertiesFile)
+	serverPropertiesFile = "./testdata/server.properties"
+
+	conf := &Conf{
+		AppID: "SampleApp",
+		MetaServers: map[string]string{
+			"DEV": "http://dev:8080",
+			"FAT": "http://fat:8080",
+		},
+	}
+	conf.resolveEnv()
+	assert.Equal(t, "FAT", conf.Env)
+	assert.Equal(t, "http://fat:8080", conf.serverAddr())
+	assert.Nil(t, conf.Validate())
+
+	// env variable take precedence over server properties
+	os.Setenv(envEnv, "dev")
+	defer os.Unsetenv(envEnv)
+	conf.Env = ""
+	conf.resolveEnv()
+	assert.Equal(t, "http://dev:8080", conf.serverAddr())
+	assert.Equal(t, "http://dev:8080/notifications/v2", strings.Split(notificationURL(conf, ""), "?")[0])
+
+	// explicit meta address take precedence over env
+	conf.MetaAddr = "http://meta:8080"
+	assert.Equal(t, "http://meta:8080", conf.serverAddr())
+
+	conf.MetaAddr = ""
+	conf.Env = "PRO"
+	assert.Equal(t, ErrUnknownEnv, conf.Validate())
+
+	conf = &Conf{}
+	assert.Equal(t, ErrNoConfProperty, unmarshalProperties([]byte("MIT License\nCopyright (c) 2018\n"), conf))
+	assert.Nil(t, unmarshalProperties([]byte("app.id=SampleApp\ndev.meta=http://dev:8080\npro.meta=http://pro:8080\nenv=PRO\n"), conf))
+	assert.Equal(t, "http://pro:8080", conf.serverAddr())
+}
+
+func TestParseProperties(t *testing.T) {
+	props, err := parseProperties(strings.NewReader(`
+# comment
+! comment
+a=1
+b : 2
+c 3
+d=multi \
+   line
+e\:f=\u4e2d\t
+g=
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"a":   "1",
+		"b":   "2",
+		"c":   "3",
+		"d":   "multi line",
+		"e:f": "中\t",
+		"g":   "",
+	}, props)
+}
+
+func TestConfBackupKeys(t *testing.T) {
+	conf := &Conf{}
+	os.Setenv(envBackupKeys, "MDEyMzQ1Njc4OWFiY2RlZg==,ZmVkY2JhOTg3NjU0MzIxMA==")
+	defer os.Unsetenv(envBackupKeys)
+
+	keys, err := conf.backupKeys()
+	if err != nil || len(keys) != 2 || string(keys[0]) != "0123456789abcdef" {
+		t.Errorf("backupKeys should read from env, got %v, %v", keys, err)
+	}
+
+	conf.BackupKeys = []string{"ZmVkY2JhOTg3NjU0MzIxMA=="}
+	keys, err = conf.backupKeys()
+	if err != nil || len(keys) != 1 || string(keys[0]) != "fedcba9876543210" {
+		t.Errorf("backupKeys should prefer conf, got %v, %v", keys, err)
+	}
+
+	conf.BackupKeys = []string{"not base64"}
+	if _, err := conf.backupKeys(); err == nil {
+		t.Error("backupKeys should return err for invalid key")
+	}
+}
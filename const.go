@@ -7,9 +7,27 @@ import (
 const (
 	defaultConfName  = "app.properties"
 	defaultNamespace = "application"
+	defaultCluster   = "default"
 
 	longPollInterval      = time.Second * 2
 	longPollTimeout       = time.Second * 90
 	queryTimeout          = time.Second * 2
 	defaultNotificationID = -1
+	refreshInterval       = time.Minute * 5
+
+	// defaultMaxResponseBytes is max decoded size of a response body
+	defaultMaxResponseBytes = 16 << 20
+
+	// defaultFetchConcurrency is max namespaces fetched at the same time
+	defaultFetchConcurrency = 8
+
+	// envBackupKeys comma separated base64 encoded AES keys to encrypt local backup
+	envBackupKeys = "APOLLO_BACKUP_KEYS"
+
+	// standard env variables override conf file
+	envAppID    = "APP_ID"
+	envMeta     = "APOLLO_META"
+	envIDC      = "IDC"
+	envCacheDir = "APOLLO_CACHE_DIR"
+	envEnv      = "ENV"
 )
@@ -0,0 +1,142 @@
+package apollo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	encryptedPrefix = "ENC("
+	encryptedSuffix = ")"
+)
+
+// ErrInvalidCiphertext returned when an encrypted value can not be decrypted
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// this is a static check
+var _ Decryptor = (*AESDecryptor)(nil)
+
+// Decryptor decrypt encrypted config values
+type Decryptor interface {
+	// Match report whether value is encrypted
+	Match(value string) bool
+	// Decrypt return plaintext of an encrypted value
+	Decrypt(value string) (string, error)
+}
+
+// AESDecryptor decrypt values in the form of ENC(base64(nonce+ciphertext)) with AES-GCM
+type AESDecryptor struct {
+	aead cipher.AEAD
+}
+
+// NewAESDecryptor create AESDecryptor, key must be 16, 24 or 32 bytes
+func NewAESDecryptor(key []byte) (*AESDecryptor, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AESDecryptor{aead: aead}, nil
+}
+
+// NewAESDecryptorFromFile create AESDecryptor with base64 encoded key in file
+func NewAESDecryptorFromFile(name string) (*AESDecryptor, error) {
+	bts, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKey(string(bts))
+	if err != nil {
+		return nil, err
+	}
+	return NewAESDecryptor(key)
+}
+
+// NewAESDecryptorFromEnv create AESDecryptor with base64 encoded key in env variable
+func NewAESDecryptorFromEnv(name string) (*AESDecryptor, error) {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("env %s not set", name)
+	}
+	key, err := decodeKey(val)
+	if err != nil {
+		return nil, err
+	}
+	return NewAESDecryptor(key)
+}
+
+// Match report whether value is in the form of ENC(...)
+func (d *AESDecryptor) Match(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+// Decrypt ENC(...) value
+func (d *AESDecryptor) Decrypt(value string) (string, error) {
+	if !d.Match(value) {
+		return "", ErrInvalidCiphertext
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix)
+	bts, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	plaintext, err := open(d.aead, bts)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Encrypt plaintext to ENC(...) value, which can be stored in apollo
+func (d *AESDecryptor) Encrypt(plaintext string) (string, error) {
+	bts, err := seal(d.aead, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(bts) + encryptedSuffix, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("key should be base64 encoded: %v", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypt plaintext, return nonce+ciphertext
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypt nonce+ciphertext
+func open(aead cipher.AEAD, bts []byte) ([]byte, error) {
+	if len(bts) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := bts[:aead.NonceSize()], bts[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
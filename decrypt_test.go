@@ -0,0 +1,87 @@
+package apollo
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestAESDecryptor(t *testing.T) {
+	d, err := NewAESDecryptor(testKey)
+	assert.Nil(t, err)
+
+	encrypted, err := d.Encrypt("secret")
+	assert.Nil(t, err)
+	assert.True(t, d.Match(encrypted))
+	assert.False(t, d.Match("secret"))
+
+	plaintext, err := d.Decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", plaintext)
+
+	_, err = d.Decrypt("ENC(bm90IGVuY3J5cHRlZA==)")
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	_, err = d.Decrypt("secret")
+	assert.Equal(t, ErrInvalidCiphertext, err)
+
+	_, err = NewAESDecryptor([]byte("short"))
+	assert.NotNil(t, err)
+}
+
+func TestAESDecryptorFromFileAndEnv(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey)
+
+	f, err := ioutil.TempFile(".", "apollo")
+	assert.Nil(t, err)
+	f.WriteString(encoded + "\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	_, err = NewAESDecryptorFromFile(f.Name())
+	assert.Nil(t, err)
+
+	_, err = NewAESDecryptorFromFile("null")
+	assert.NotNil(t, err)
+
+	os.Setenv("APOLLO_TEST_DECRYPT_KEY", encoded)
+	defer os.Unsetenv("APOLLO_TEST_DECRYPT_KEY")
+	_, err = NewAESDecryptorFromEnv("APOLLO_TEST_DECRYPT_KEY")
+	assert.Nil(t, err)
+
+	_, err = NewAESDecryptorFromEnv("APOLLO_TEST_NOT_EXIST")
+	assert.NotNil(t, err)
+}
+
+func TestClientDecrypt(t *testing.T) {
+	d, _ := NewAESDecryptor(testKey)
+	encrypted, _ := d.Encrypt("secret")
+
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, Decryptor: d})
+	client.decryptor, _ = client.conf.newDecryptor()
+	events := client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"password": encrypted, "broken": "ENC(broken)"},
+	})
+
+	assert.Equal(t, "secret", client.GetStringValue("password", ""))
+	assert.Equal(t, "default", client.GetStringValue("broken", "default"))
+	assert.Equal(t, map[string]string{"password": encrypted, "broken": "ENC(broken)"},
+		client.mustGetCache(defaultNamespace).dump())
+	assert.Equal(t, "secret", events[0].Changes["password"].NewValue)
+	assert.Equal(t, "", events[0].Changes["broken"].NewValue)
+	assert.Equal(t, ErrInvalidCiphertext, events[0].Changes["broken"].Err)
+
+	bts, err := ioutil.ReadFile(client.getDumpFileName())
+	assert.Nil(t, err)
+	assert.NotContains(t, string(bts), "secret")
+}
@@ -0,0 +1,321 @@
+package apollo
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// defaultSubscriberBuffer is the number of events a subscriber can fall behind
+// before consecutive changes are coalesced
+const defaultSubscriberBuffer = 32
+
+// dispatcher delivery change events to subscribers, publishing never blocks:
+// each subscriber has its own buffer, and a lagging subscriber gets coalesced
+// changes instead of stalling the poller
+type dispatcher struct {
+	lock        sync.Mutex
+	seq         uint64
+	subscribers map[*Subscription]struct{}
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// publish assign a sequence number to event and push it to all subscribers
+func (d *dispatcher) publish(event *ChangeEvent) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.seq++
+	event.Sequence = d.seq
+	for sub := range d.subscribers {
+		sub.push(event)
+	}
+}
+
+// SubscribeOption configure a subscription
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	buffer   int
+	snapshot bool
+}
+
+// WithBuffer set how many events a subscriber can fall behind before changes are coalesced
+func WithBuffer(buffer int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.buffer = buffer
+	}
+}
+
+// WithSnapshot deliver a snapshot event of current contents for each namespace
+// first, sequenced before any later change, so state can be built from events alone
+func WithSnapshot() SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.snapshot = true
+	}
+}
+
+func newSubscribeOptions(opts []SubscribeOption) *subscribeOptions {
+	var o = &subscribeOptions{buffer: defaultSubscriberBuffer}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.buffer <= 0 {
+		o.buffer = defaultSubscriberBuffer
+	}
+	return o
+}
+
+// subscribe create a subscription receive snapshot first, then events published
+// from now on. The caller must make sure no event is published between taking
+// snapshot and subscribing.
+func (d *dispatcher) subscribe(buffer int, snapshot []*ChangeEvent) *Subscription {
+	sub := &Subscription{
+		dispatcher: d,
+		buffer:     buffer,
+		events:     make(chan *ChangeEvent),
+		notify:     make(chan struct{}, 1),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+		exited:     make(chan struct{}),
+	}
+
+	d.lock.Lock()
+	for _, event := range snapshot {
+		d.seq++
+		event.Sequence = d.seq
+		sub.push(event)
+	}
+	d.subscribers[sub] = struct{}{}
+	d.lock.Unlock()
+
+	go sub.run()
+	return sub
+}
+
+// close remove all subscribers, each of them receives pending events then its
+// channel is closed. If ctx is done before that, channels are closed immediately.
+func (d *dispatcher) close(ctx context.Context) error {
+	d.lock.Lock()
+	var subs []*Subscription
+	for sub := range d.subscribers {
+		subs = append(subs, sub)
+		close(sub.closing)
+	}
+	d.subscribers = map[*Subscription]struct{}{}
+	d.lock.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case <-sub.exited:
+		case <-ctx.Done():
+			for _, sub := range subs {
+				sub.Close()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (d *dispatcher) unsubscribe(sub *Subscription) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.subscribers, sub)
+}
+
+// Subscription receive change events with monotonic sequence numbers. Sequence
+// numbers may have gaps, when a subscriber falls more than its buffer behind,
+// pending events of the same namespace are coalesced, and snapshot events of
+// other subscribers are skipped.
+type Subscription struct {
+	dispatcher *dispatcher
+	buffer     int
+
+	lock      sync.Mutex
+	pending   []*ChangeEvent
+	coalesced uint64
+	// sending is true when an event is popped from pending but not received yet
+	sending bool
+
+	events chan *ChangeEvent
+	notify chan struct{}
+	// closing is closed when client stops, subscriber exits after pending events received
+	closing chan struct{}
+	// done is closed when subscription closed, subscriber exits immediately
+	done   chan struct{}
+	exited chan struct{}
+	once   sync.Once
+}
+
+// Events return channel of change events, which is closed after subscription
+// closed or client stopped
+func (s *Subscription) Events() <-chan *ChangeEvent {
+	return s.events
+}
+
+// Lag return how many events pushed to subscriber are not received yet, events
+// coalesced away are not counted
+func (s *Subscription) Lag() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lag := uint64(len(s.pending))
+	if s.sending {
+		lag++
+	}
+	return lag
+}
+
+// Coalesced return how many events were merged into others because subscriber lagged
+func (s *Subscription) Coalesced() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.coalesced
+}
+
+// Close stop receiving events
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.dispatcher.unsubscribe(s)
+		close(s.done)
+	})
+}
+
+func (s *Subscription) push(event *ChangeEvent) {
+	s.lock.Lock()
+	s.pending = append(s.pending, event)
+	if len(s.pending) > s.buffer {
+		before := len(s.pending)
+		s.pending = coalesce(s.pending)
+		s.coalesced += uint64(before - len(s.pending))
+	}
+	s.lock.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) pop() (*ChangeEvent, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil, false
+	}
+	event := s.pending[0]
+	s.pending[0] = nil
+	s.pending = s.pending[1:]
+	s.sending = true
+	return event, true
+}
+
+func (s *Subscription) markDelivered() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sending = false
+}
+
+func (s *Subscription) run() {
+	defer close(s.exited)
+	defer close(s.events)
+
+	var closing bool
+	for {
+		event, ok := s.pop()
+		if !ok {
+			if closing {
+				return
+			}
+			select {
+			case <-s.notify:
+			case <-s.closing:
+				// no more pushes after closing, exit once pending events received
+				closing = true
+			case <-s.done:
+				return
+			}
+			continue
+		}
+
+		select {
+		case s.events <- event:
+			s.markDelivered()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// coalesce merge events of the same namespace, merged event takes the sequence
+// of the last merged one, and events are kept in sequence order
+func coalesce(events []*ChangeEvent) []*ChangeEvent {
+	var ret []*ChangeEvent
+	var merged = map[string]*ChangeEvent{}
+	for _, event := range events {
+		prev, ok := merged[event.Namespace]
+		if !ok {
+			prev = &ChangeEvent{Changes: map[string]*Change{}, OldReleaseKey: event.OldReleaseKey}
+			merged[event.Namespace] = prev
+			ret = append(ret, prev)
+		}
+		// take metadata of the latest event, except where the changes start from
+		changes, oldReleaseKey := prev.Changes, prev.OldReleaseKey
+		*prev = *event
+		prev.Changes, prev.OldReleaseKey = changes, oldReleaseKey
+		for key, change := range event.Changes {
+			if c := mergeChange(prev.Changes[key], change); c != nil {
+				prev.Changes[key] = c
+			} else {
+				delete(prev.Changes, key)
+			}
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Sequence < ret[j].Sequence
+	})
+
+	// drop events whose changes all cancel out
+	var n int
+	for _, event := range ret {
+		if len(event.Changes) > 0 {
+			ret[n] = event
+			n++
+		}
+	}
+	return ret[:n]
+}
+
+// mergeChange merge two consecutive changes of a key, return nil if they cancel out
+func mergeChange(prev, next *Change) *Change {
+	if prev == nil {
+		return next
+	}
+
+	var ret *Change
+	switch {
+	case prev.ChangeType == ADD && next.ChangeType == DELETE:
+		return nil
+	case prev.ChangeType == ADD:
+		ret = makeAddChange("", next.NewValue)
+	case next.ChangeType == DELETE:
+		ret = makeDeleteChange("", prev.OldValue)
+	case prev.OldValue == next.NewValue:
+		return nil
+	default:
+		ret = makeModifyChange("", prev.OldValue, next.NewValue)
+	}
+	ret.Derived = prev.Derived && next.Derived
+	return ret
+}
@@ -0,0 +1,163 @@
+package apollo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcher(t *testing.T) {
+	d := newDispatcher()
+	fast := d.subscribe(defaultSubscriberBuffer, nil)
+	defer fast.Close()
+	slow := d.subscribe(2, nil)
+	defer slow.Close()
+
+	events := []*ChangeEvent{
+		{Namespace: "a", Changes: map[string]*Change{"k": makeAddChange("k", "1")}},
+		{Namespace: "b", Changes: map[string]*Change{"k": makeAddChange("k", "1")}},
+		{Namespace: "a", Changes: map[string]*Change{"k": makeModifyChange("k", "1", "2")}},
+		{Namespace: "a", Changes: map[string]*Change{"k": makeModifyChange("k", "2", "3")}},
+	}
+
+	// publish never blocks, even if nobody receives
+	for _, event := range events {
+		d.publish(event)
+	}
+
+	for i := range events {
+		select {
+		case event := <-fast.Events():
+			assert.Equal(t, uint64(i+1), event.Sequence)
+		case <-time.After(time.Second):
+			t.Fatal("fast subscriber should receive all events")
+		}
+	}
+	waitFor(t, func() bool { return fast.Lag() == 0 })
+
+	// the first event may be in flight, the rest are coalesced by namespace, lag
+	// counts events to receive, not the ones coalesced away
+	lag := slow.Lag()
+	assert.True(t, lag < uint64(len(events)), "lag %d", lag)
+	var received []*ChangeEvent
+	for i := uint64(0); i < lag; i++ {
+		select {
+		case event := <-slow.Events():
+			received = append(received, event)
+		case <-time.After(time.Second):
+			t.Fatal("slow subscriber should receive coalesced events")
+		}
+	}
+	waitFor(t, func() bool { return slow.Lag() == 0 })
+	select {
+	case event := <-slow.Events():
+		t.Fatalf("no more event should be received, got %v", event)
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.True(t, slow.Coalesced() > 0)
+	last := received[len(received)-1]
+	assert.Equal(t, uint64(4), last.Sequence)
+	assert.Equal(t, "3", last.Changes["k"].NewValue)
+	for i := 1; i < len(received); i++ {
+		assert.True(t, received[i].Sequence > received[i-1].Sequence)
+	}
+
+	slow.Close()
+	d.publish(&ChangeEvent{Namespace: "a"})
+	assert.Len(t, d.subscribers, 1)
+}
+
+func TestSubscriptionLag(t *testing.T) {
+	d := newDispatcher()
+	sub := d.subscribe(defaultSubscriberBuffer, nil)
+	defer sub.Close()
+
+	// snapshot of another subscriber takes sequence numbers, but isn't pushed to sub
+	other := d.subscribe(defaultSubscriberBuffer, []*ChangeEvent{{Namespace: "a"}, {Namespace: "b"}})
+	defer other.Close()
+	assert.Equal(t, uint64(0), sub.Lag())
+	assert.Equal(t, uint64(2), other.Lag())
+
+	d.publish(&ChangeEvent{Namespace: "a", Changes: map[string]*Change{"k": makeAddChange("k", "1")}})
+	assert.Equal(t, uint64(1), sub.Lag())
+	<-sub.Events()
+	waitFor(t, func() bool { return sub.Lag() == 0 })
+}
+
+func TestMergeChange(t *testing.T) {
+	var tcs = []struct {
+		prev, next, want *Change
+	}{
+		{nil, makeAddChange("", "1"), makeAddChange("", "1")},
+		{makeAddChange("", "1"), makeModifyChange("", "1", "2"), makeAddChange("", "2")},
+		{makeAddChange("", "1"), makeDeleteChange("", "1"), nil},
+		{makeModifyChange("", "1", "2"), makeModifyChange("", "2", "3"), makeModifyChange("", "1", "3")},
+		{makeModifyChange("", "1", "2"), makeModifyChange("", "2", "1"), nil},
+		{makeModifyChange("", "1", "2"), makeDeleteChange("", "2"), makeDeleteChange("", "1")},
+		{makeDeleteChange("", "1"), makeAddChange("", "2"), makeModifyChange("", "1", "2")},
+		{makeDeleteChange("", "1"), makeAddChange("", "1"), nil},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.want, mergeChange(tc.prev, tc.next))
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	events := coalesce([]*ChangeEvent{
+		{Sequence: 1, Namespace: "a", Changes: map[string]*Change{"k": makeAddChange("k", "1")}},
+		{Sequence: 2, Namespace: "b", Changes: map[string]*Change{"k": makeAddChange("k", "1")}},
+		{Sequence: 3, Namespace: "a", Changes: map[string]*Change{"k": makeDeleteChange("k", "1")}},
+		{Sequence: 4, Namespace: "b", Changes: map[string]*Change{"j": makeAddChange("j", "1")}},
+	})
+	assert.Equal(t, []*ChangeEvent{
+		{Sequence: 4, Namespace: "b", Changes: map[string]*Change{
+			"k": makeAddChange("k", "1"),
+			"j": makeAddChange("j", "1"),
+		}},
+	}, events)
+}
+
+// waitFor condition to be true in a second
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not satisfied in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherClose(t *testing.T) {
+	d := newDispatcher()
+	sub := d.subscribe(defaultSubscriberBuffer, nil)
+	d.publish(&ChangeEvent{Namespace: "a"})
+	d.publish(&ChangeEvent{Namespace: "b"})
+
+	// pending events are received before channel closed
+	done := make(chan error)
+	go func() { done <- d.close(context.Background()) }()
+	assert.Equal(t, "a", (<-sub.Events()).Namespace)
+	assert.Equal(t, "b", (<-sub.Events()).Namespace)
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	assert.Nil(t, <-done)
+
+	// subscriber stop reading, close returns when ctx done
+	stuck := d.subscribe(defaultSubscriberBuffer, nil)
+	d.publish(&ChangeEvent{Namespace: "a"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, d.close(ctx))
+	for range stuck.Events() {
+		// channel is closed, at most the in-flight event may be received
+	}
+
+	// dispatcher still works after close
+	sub = d.subscribe(defaultSubscriberBuffer, nil)
+	defer sub.Close()
+	d.publish(&ChangeEvent{Namespace: "c"})
+	assert.Equal(t, "c", (<-sub.Events()).Namespace)
+}
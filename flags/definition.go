@@ -0,0 +1,267 @@
+package flags
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Operators of rules
+const (
+	OpIn       = "in"
+	OpNotIn    = "not_in"
+	OpPrefix   = "prefix"
+	OpSuffix   = "suffix"
+	OpContains = "contains"
+	OpGT       = "gt"
+	OpGTE      = "gte"
+	OpLT       = "lt"
+	OpLTE      = "lte"
+)
+
+// AttributeID refer to User.ID in rules
+const AttributeID = "id"
+
+// buckets of percentage rollout, so percentage has 2 decimal places
+const buckets = 10000
+
+// Definition of a flag stored as JSON value
+type Definition struct {
+	// Enabled is a kill switch, flag with enabled false is off for everyone
+	Enabled *bool `json:"enabled,omitempty"`
+	// Rules are matched in order, the first matched one decides
+	Rules []*Rule `json:"rules,omitempty"`
+	// Percentage of users the flag is on for when no rule matches, 0-100
+	Percentage *float64 `json:"percentage,omitempty"`
+	// Default is the result when no rule matches and percentage isn't set
+	Default bool `json:"default,omitempty"`
+	// Salt of hashing user id, default flag name, so rollouts of flags are independent
+	Salt string `json:"salt,omitempty"`
+}
+
+// Rule match an attribute of user
+type Rule struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values"`
+	// Enabled is the result of matched users, default true
+	Enabled *bool `json:"enabled,omitempty"`
+	// Percentage of matched users the flag is on for, overrides Enabled
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+// User a flag is evaluated for
+type User struct {
+	// ID is hashed for percentage rollouts, and matched by rules of attribute "id"
+	ID         string
+	Attributes map[string]string
+}
+
+func (u User) attribute(name string) (string, bool) {
+	if value, ok := u.Attributes[name]; ok {
+		return value, true
+	}
+	if name == AttributeID && u.ID != "" {
+		return u.ID, true
+	}
+	return "", false
+}
+
+// parse flag value, which is a boolean like "true", a percentage like "25%", or
+// a JSON definition
+func parse(value string) (*Definition, error) {
+	value = strings.TrimSpace(value)
+
+	if b, err := strconv.ParseBool(value); err == nil {
+		return &Definition{Default: b}, nil
+	}
+
+	if strings.HasSuffix(value, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+		if err != nil {
+			return nil, fmt.Errorf("flags: invalid percentage %q", value)
+		}
+		def := &Definition{Percentage: &p}
+		return def, def.validate()
+	}
+
+	if strings.HasPrefix(value, "{") {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+		decoder.DisallowUnknownFields()
+		def := &Definition{}
+		if err := decoder.Decode(def); err != nil {
+			return nil, fmt.Errorf("flags: invalid definition: %v", err)
+		}
+		return def, def.validate()
+	}
+
+	return nil, fmt.Errorf("flags: invalid flag value %q", value)
+}
+
+func (d *Definition) validate() error {
+	if err := validatePercentage(d.Percentage); err != nil {
+		return err
+	}
+	for i, rule := range d.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("flags: rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	if r.Attribute == "" {
+		return fmt.Errorf("no attribute")
+	}
+	if len(r.Values) == 0 {
+		return fmt.Errorf("no values")
+	}
+	switch r.Operator {
+	case OpIn, OpNotIn, OpPrefix, OpSuffix, OpContains:
+	case OpGT, OpGTE, OpLT, OpLTE:
+		if _, err := strconv.ParseFloat(r.Values[0], 64); err != nil {
+			return fmt.Errorf("operator %s needs a number, got %q", r.Operator, r.Values[0])
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", r.Operator)
+	}
+	return validatePercentage(r.Percentage)
+}
+
+func validatePercentage(p *float64) error {
+	if p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("flags: percentage %v out of range 0-100", *p)
+	}
+	return nil
+}
+
+// evaluate definition of flag for user, record how the result is made to e
+func (d *Definition) evaluate(name string, user User, e *Evaluation) {
+	if d.Enabled != nil && !*d.Enabled {
+		e.Reason = ReasonDisabled
+		e.tracef("flag is disabled")
+		return
+	}
+
+	for i, rule := range d.Rules {
+		if !rule.match(user, e, i) {
+			continue
+		}
+		e.Rule = i
+		e.Reason = ReasonRule
+		if rule.Percentage != nil {
+			e.Enabled = d.rollout(name, user, *rule.Percentage, e)
+			return
+		}
+		e.Enabled = rule.Enabled == nil || *rule.Enabled
+		e.tracef("rule %d serves %v", i, e.Enabled)
+		return
+	}
+
+	if d.Percentage != nil {
+		e.Reason = ReasonPercentage
+		e.Enabled = d.rollout(name, user, *d.Percentage, e)
+		return
+	}
+	e.Reason = ReasonDefault
+	e.Enabled = d.Default
+	e.tracef("default %v", d.Default)
+}
+
+// rollout report whether user falls in percentage, users without id are never in
+func (d *Definition) rollout(name string, user User, percentage float64, e *Evaluation) bool {
+	if user.ID == "" {
+		e.tracef("no user id for %v%% rollout: off", percentage)
+		return false
+	}
+	salt := d.Salt
+	if salt == "" {
+		salt = name
+	}
+	b := bucket(salt, user.ID)
+	in := float64(b) < percentage*buckets/100
+	e.tracef("user %q in bucket %.2f of %v%% rollout: %s", user.ID, float64(b)*100/buckets, percentage, onOff(in))
+	return in
+}
+
+// bucket hash id with salt consistently to [0, buckets)
+func bucket(salt, id string) uint32 {
+	sum := sha1.Sum([]byte(salt + "/" + id))
+	return binary.BigEndian.Uint32(sum[:4]) % buckets
+}
+
+func (r *Rule) match(user User, e *Evaluation, i int) bool {
+	value, ok := user.attribute(r.Attribute)
+	if !ok {
+		e.tracef("rule %d: attribute %q missing: no match", i, r.Attribute)
+		return false
+	}
+
+	var matched bool
+	switch r.Operator {
+	case OpIn:
+		matched = contains(r.Values, value)
+	case OpNotIn:
+		matched = !contains(r.Values, value)
+	case OpPrefix:
+		matched = anyOf(r.Values, func(v string) bool { return strings.HasPrefix(value, v) })
+	case OpSuffix:
+		matched = anyOf(r.Values, func(v string) bool { return strings.HasSuffix(value, v) })
+	case OpContains:
+		matched = anyOf(r.Values, func(v string) bool { return strings.Contains(value, v) })
+	case OpGT, OpGTE, OpLT, OpLTE:
+		matched = compare(r.Operator, value, r.Values[0])
+	}
+	e.tracef("rule %d: %s %q %s %v: %s", i, r.Attribute, value, r.Operator, r.Values, matchOrNot(matched))
+	return matched
+}
+
+func contains(values []string, value string) bool {
+	return anyOf(values, func(v string) bool { return v == value })
+}
+
+func anyOf(values []string, fn func(string) bool) bool {
+	for _, v := range values {
+		if fn(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare numbers, value not a number never matches
+func compare(op, value, target string) bool {
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	y, _ := strconv.ParseFloat(target, 64)
+	switch op {
+	case OpGT:
+		return x > y
+	case OpGTE:
+		return x >= y
+	case OpLT:
+		return x < y
+	}
+	return x <= y
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func matchOrNot(b bool) string {
+	if b {
+		return "match"
+	}
+	return "no match"
+}
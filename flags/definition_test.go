@@ -0,0 +1,110 @@
+package flags
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func evaluate(t *testing.T, value string, user User) *Evaluation {
+	def, err := parse(value)
+	assert.Nil(t, err)
+	e := &Evaluation{Flag: "flag", Rule: -1}
+	def.evaluate("flag", user, e)
+	return e
+}
+
+func TestParse(t *testing.T) {
+	for _, value := range []string{"true", " false ", "1", "25%", "0.5 %", `{}`, `{"percentage": 100, "salt": "s"}`,
+		`{"rules": [{"attribute": "age", "operator": "gte", "values": ["18"]}]}`} {
+		_, err := parse(value)
+		assert.Nil(t, err, value)
+	}
+
+	for _, value := range []string{"yes", "abc%", "101%", "-1%", `{"percent": 10}`, `{"percentage": 200}`,
+		`{"rules": [{"attribute": "id", "operator": "eq", "values": ["a"]}]}`,
+		`{"rules": [{"attribute": "id", "operator": "in"}]}`,
+		`{"rules": [{"operator": "in", "values": ["a"]}]}`,
+		`{"rules": [{"attribute": "age", "operator": "gt", "values": ["old"]}]}`,
+		`{"rules": [{"attribute": "id", "operator": "in", "values": ["a"], "percentage": -1}]}`} {
+		_, err := parse(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	e := evaluate(t, "true", User{})
+	assert.True(t, e.Enabled)
+	assert.Equal(t, ReasonDefault, e.Reason)
+
+	def := `{
+		"rules": [
+			{"attribute": "id", "operator": "in", "values": ["alice", "bob"]},
+			{"attribute": "email", "operator": "suffix", "values": ["@example.com"], "enabled": false},
+			{"attribute": "version", "operator": "lt", "values": ["3"], "percentage": 0},
+			{"attribute": "country", "operator": "not_in", "values": ["CN", "US"], "percentage": 100}
+		],
+		"default": true
+	}`
+	cases := []struct {
+		user    User
+		enabled bool
+		reason  Reason
+		rule    int
+	}{
+		{User{ID: "alice"}, true, ReasonRule, 0},
+		{User{ID: "carol", Attributes: map[string]string{"id": "bob"}}, true, ReasonRule, 0},
+		{User{ID: "carol", Attributes: map[string]string{"email": "carol@example.com"}}, false, ReasonRule, 1},
+		{User{ID: "carol", Attributes: map[string]string{"version": "2.5"}}, false, ReasonRule, 2},
+		{User{ID: "carol", Attributes: map[string]string{"version": "x"}}, true, ReasonDefault, -1},
+		{User{ID: "carol", Attributes: map[string]string{"country": "JP"}}, true, ReasonRule, 3},
+		{User{Attributes: map[string]string{"country": "JP"}}, false, ReasonRule, 3},
+		{User{ID: "carol", Attributes: map[string]string{"country": "CN"}}, true, ReasonDefault, -1},
+	}
+	for i, c := range cases {
+		e := evaluate(t, def, c.user)
+		assert.Equal(t, c.enabled, e.Enabled, fmt.Sprint(i))
+		assert.Equal(t, c.reason, e.Reason, fmt.Sprint(i))
+		assert.Equal(t, c.rule, e.Rule, fmt.Sprint(i))
+	}
+
+	e = evaluate(t, `{"enabled": false, "rules": [{"attribute": "id", "operator": "in", "values": ["alice"]}]}`, User{ID: "alice"})
+	assert.False(t, e.Enabled)
+	assert.Equal(t, ReasonDisabled, e.Reason)
+
+	e = evaluate(t, def, User{ID: "carol", Attributes: map[string]string{"email": "carol@example.com"}})
+	assert.Equal(t, []string{
+		`rule 0: id "carol" in [alice bob]: no match`,
+		`rule 1: email "carol@example.com" suffix [@example.com]: match`,
+		`rule 1 serves false`,
+	}, e.Trace)
+	assert.Equal(t, `flag "flag": off (rule 1): `+
+		`rule 0: id "carol" in [alice bob]: no match; `+
+		`rule 1: email "carol@example.com" suffix [@example.com]: match; `+
+		`rule 1 serves false`, e.String())
+}
+
+func TestRollout(t *testing.T) {
+	var on int
+	for i := 0; i < 10000; i++ {
+		user := User{ID: fmt.Sprint("user", i)}
+		e := evaluate(t, "25%", user)
+		assert.Equal(t, ReasonPercentage, e.Reason)
+		if e.Enabled {
+			on++
+			// consistent for the same user, and users in rollout stay in when it grows
+			assert.True(t, evaluate(t, "25%", user).Enabled)
+			assert.True(t, evaluate(t, "50%", user).Enabled)
+		}
+	}
+	assert.InDelta(t, 2500, on, 200)
+
+	assert.False(t, evaluate(t, "100%", User{}).Enabled)
+	assert.False(t, evaluate(t, "0%", User{ID: "alice"}).Enabled)
+	assert.True(t, evaluate(t, "100%", User{ID: "alice"}).Enabled)
+
+	// salt decide bucket of user
+	assert.Equal(t, bucket("flag", "alice"), bucket("flag", "alice"))
+	assert.NotEqual(t, bucket("a", "alice"), bucket("b", "alice"))
+}
@@ -0,0 +1,213 @@
+// Package flags evaluate feature flags stored as keys of an Apollo namespace.
+// A flag value is one of:
+//
+//	true                                   on for everyone, false for no one
+//	25%                                    on for 25% of users, by hash of user id
+//	{"rules": [...], "percentage": 10}     a JSON Definition
+//
+// Rules of a definition match user attributes in order, and the first matched
+// one decides; users matching no rule fall back to percentage, then default:
+//
+//	{
+//	  "rules": [
+//	    {"attribute": "id", "operator": "in", "values": ["alice", "bob"]},
+//	    {"attribute": "country", "operator": "in", "values": ["CN"], "percentage": 50},
+//	    {"attribute": "version", "operator": "lt", "values": ["3"], "enabled": false}
+//	  ],
+//	  "percentage": 10
+//	}
+//
+// Flags are read from the client on every evaluation, so results follow releases
+// at once; listeners registered by OnChange are called with names of changed flags.
+package flags
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	apollo "github.com/liamylian/apollo-client"
+)
+
+const defaultNamespace = "application"
+
+// Reason of an evaluation result
+type Reason string
+
+// Reasons of evaluation results
+const (
+	// ReasonMissing flag doesn't exist, it's off
+	ReasonMissing Reason = "missing"
+	// ReasonInvalid flag value can't be parsed, it's off
+	ReasonInvalid Reason = "invalid"
+	// ReasonDisabled flag is killed by "enabled": false
+	ReasonDisabled Reason = "disabled"
+	// ReasonRule a rule matched
+	ReasonRule Reason = "rule"
+	// ReasonPercentage no rule matched, decided by percentage rollout
+	ReasonPercentage Reason = "percentage"
+	// ReasonDefault no rule matched and no percentage, decided by boolean value or default
+	ReasonDefault Reason = "default"
+)
+
+// Evaluation is result of a flag for a user, with how it's made
+type Evaluation struct {
+	Flag    string
+	Enabled bool
+	Reason  Reason
+	// Rule is index of the matched rule, -1 if none matched
+	Rule int
+	// Value is the raw flag value evaluated
+	Value string
+	// Err is why the value is invalid
+	Err error
+	// Trace of steps, for debugging
+	Trace []string
+}
+
+func (e *Evaluation) tracef(format string, args ...interface{}) {
+	e.Trace = append(e.Trace, fmt.Sprintf(format, args...))
+}
+
+// String describe the evaluation, like `flag "new-ui": on (rule 0): ...`
+func (e *Evaluation) String() string {
+	reason := string(e.Reason)
+	if e.Reason == ReasonRule {
+		reason = fmt.Sprintf("rule %d", e.Rule)
+	}
+	return fmt.Sprintf("flag %q: %s (%s): %s", e.Flag, onOff(e.Enabled), reason, strings.Join(e.Trace, "; "))
+}
+
+// entry is a parsed flag value
+type entry struct {
+	value string
+	def   *Definition
+	err   error
+}
+
+// Flags evaluate flags of a namespace of client
+type Flags struct {
+	client    *apollo.Client
+	namespace string
+	sub       *apollo.Subscription
+	done      chan struct{}
+	once      sync.Once
+
+	lock      sync.RWMutex
+	entries   map[string]*entry
+	listeners []func(flag string)
+}
+
+// New create flags stored in namespace of client, default namespace application.
+// Close should be called after use.
+func New(client *apollo.Client, namespace string) (*Flags, error) {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	if err := client.SubscribeToNamespaces(namespace); err != nil {
+		return nil, err
+	}
+
+	f := &Flags{
+		client:    client,
+		namespace: namespace,
+		sub:       client.Subscribe(),
+		done:      make(chan struct{}),
+		entries:   map[string]*entry{},
+	}
+	go f.watch()
+	return f, nil
+}
+
+// Enabled report whether flag is on for user, missing or invalid flags are off
+func (f *Flags) Enabled(flag string, user User) bool {
+	return f.Evaluate(flag, user).Enabled
+}
+
+// Evaluate flag for user, with a trace of how the result is made
+func (f *Flags) Evaluate(flag string, user User) *Evaluation {
+	e := &Evaluation{Flag: flag, Rule: -1}
+	e.Value = f.client.GetStringValueWithNameSpace(f.namespace, flag, "")
+	if e.Value == "" {
+		e.Reason = ReasonMissing
+		e.tracef("flag missing in namespace %s", f.namespace)
+		return e
+	}
+	e.tracef("value %q", e.Value)
+
+	ent := f.parse(flag, e.Value)
+	if ent.err != nil {
+		e.Reason = ReasonInvalid
+		e.Err = ent.err
+		e.tracef("%v", ent.err)
+		return e
+	}
+	ent.def.evaluate(flag, user, e)
+	return e
+}
+
+// parse flag value, parsed values are cached until value changes
+func (f *Flags) parse(flag, value string) *entry {
+	f.lock.RLock()
+	ent, ok := f.entries[flag]
+	f.lock.RUnlock()
+	if ok && ent.value == value {
+		return ent
+	}
+
+	def, err := parse(value)
+	if err != nil {
+		log.Printf("[apollo] err parse flag %s: %v", flag, err)
+	}
+	ent = &entry{value: value, def: def, err: err}
+
+	f.lock.Lock()
+	f.entries[flag] = ent
+	f.lock.Unlock()
+	return ent
+}
+
+// OnChange register listener called with name of flag changed by a release
+func (f *Flags) OnChange(listener func(flag string)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.listeners = append(f.listeners, listener)
+}
+
+// Close stop watching changes, listeners are not called after Close returns
+func (f *Flags) Close() {
+	f.once.Do(f.sub.Close)
+	<-f.done
+}
+
+func (f *Flags) watch() {
+	defer close(f.done)
+
+	for event := range f.sub.Events() {
+		if event.Namespace != f.namespace {
+			continue
+		}
+
+		flags := make([]string, 0, len(event.Changes))
+		for flag := range event.Changes {
+			flags = append(flags, flag)
+		}
+		sort.Strings(flags)
+
+		f.lock.Lock()
+		for _, flag := range flags {
+			delete(f.entries, flag)
+		}
+		listeners := f.listeners
+		f.lock.Unlock()
+
+		for _, flag := range flags {
+			for _, listener := range listeners {
+				listener(flag)
+			}
+		}
+	}
+}
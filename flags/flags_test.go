@@ -0,0 +1,64 @@
+package flags
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+	"github.com/liamylian/apollo-client/apollotest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlags(t *testing.T) {
+	srv := apollotest.NewServer()
+	defer srv.Close()
+	srv.Publish("flags", map[string]string{
+		"new-ui":  "false",
+		"invalid": "maybe",
+		"beta":    `{"rules": [{"attribute": "id", "operator": "in", "values": ["alice"]}]}`,
+	})
+
+	dir, err := ioutil.TempDir("", "flags")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := apollo.NewClient(srv.Conf(dir, "flags"))
+	assert.Nil(t, client.Start())
+	defer client.Stop(context.Background())
+
+	flags, err := New(client, "flags")
+	assert.Nil(t, err)
+	defer flags.Close()
+
+	alice := User{ID: "alice"}
+	assert.False(t, flags.Enabled("new-ui", alice))
+	assert.True(t, flags.Enabled("beta", alice))
+	assert.False(t, flags.Enabled("beta", User{ID: "bob"}))
+
+	e := flags.Evaluate("missing", alice)
+	assert.False(t, e.Enabled)
+	assert.Equal(t, ReasonMissing, e.Reason)
+	e = flags.Evaluate("invalid", alice)
+	assert.False(t, e.Enabled)
+	assert.Equal(t, ReasonInvalid, e.Reason)
+	assert.NotNil(t, e.Err)
+	assert.Equal(t, []string{`value "maybe"`, `flags: invalid flag value "maybe"`}, e.Trace)
+
+	changed := make(chan string, 10)
+	flags.OnChange(func(flag string) { changed <- flag })
+	srv.Set("flags", "new-ui", "true")
+
+	select {
+	case flag := <-changed:
+		assert.Equal(t, "new-ui", flag)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change should be notified")
+	}
+	assert.True(t, flags.Enabled("new-ui", alice))
+
+	flags.Close()
+	flags.Close()
+}
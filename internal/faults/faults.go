@@ -0,0 +1,244 @@
+// Package faults record requests to a fake config service, and inject faults
+// into its responses
+package faults
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint of config service
+type Endpoint string
+
+// Endpoints of config service
+const (
+	EndpointNotifications Endpoint = "notifications"
+	EndpointConfigs       Endpoint = "configs"
+	EndpointConfigFiles   Endpoint = "configfiles"
+)
+
+// Fault is a failure injected into requests matching Endpoint and Namespace
+type Fault struct {
+	// Endpoint to fail, empty for all endpoints
+	Endpoint Endpoint
+	// Namespace to fail, empty for all namespaces. A notification request
+	// matches if it polls the namespace.
+	Namespace string
+	// Times is how many requests to fail, 0 for all until removed
+	Times int
+
+	// Latency delay the response
+	Latency time.Duration
+	// Status respond the status with an empty body, like 500 or 404
+	Status int
+	// Truncate cut the response body in half
+	Truncate bool
+	// Malformed respond invalid JSON
+	Malformed bool
+	// Reset close the connection without response
+	Reset bool
+	// Hang never respond until the client gives up or the server is closed
+	Hang bool
+}
+
+// fault is an injected Fault with its remaining times
+type fault struct {
+	Fault
+	remaining int
+}
+
+// Request is a request received by server
+type Request struct {
+	Endpoint Endpoint
+	// AppID, Cluster and Namespace from path, Namespace is empty for notifications
+	AppID     string
+	Cluster   string
+	Namespace string
+	Query     url.Values
+	Time      time.Time
+}
+
+// notification is what notification requests poll
+type notification struct {
+	NamespaceName string `json:"namespaceName"`
+}
+
+// Injector record requests to handlers, and inject faults into them
+type Injector struct {
+	lock     sync.Mutex
+	faults   []*fault
+	requests []Request
+}
+
+// Inject fault into following requests, return a func to remove it.
+// Faults are matched in the order they are injected.
+func (in *Injector) Inject(f Fault) (remove func()) {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	injected := &fault{Fault: f, remaining: f.Times}
+	in.faults = append(in.faults, injected)
+	return func() {
+		in.lock.Lock()
+		defer in.lock.Unlock()
+		in.removeFault(injected)
+	}
+}
+
+// ClearFaults remove all injected faults
+func (in *Injector) ClearFaults() {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	in.faults = nil
+}
+
+// Requests return requests received at endpoint in order, all requests if endpoint is empty
+func (in *Injector) Requests(endpoint Endpoint) []Request {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	var ret []Request
+	for _, req := range in.requests {
+		if endpoint == "" || req.Endpoint == endpoint {
+			ret = append(ret, req)
+		}
+	}
+	return ret
+}
+
+// RequestCount return count of requests received at endpoint, all requests if endpoint is empty
+func (in *Injector) RequestCount(endpoint Endpoint) int {
+	return len(in.Requests(endpoint))
+}
+
+// ResetRequests forget received requests
+func (in *Injector) ResetRequests() {
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	in.requests = nil
+}
+
+func (in *Injector) removeFault(f *fault) {
+	for i, injected := range in.faults {
+		if injected == f {
+			in.faults = append(in.faults[:i], in.faults[i+1:]...)
+			return
+		}
+	}
+}
+
+// record request and take the first matching fault
+func (in *Injector) record(endpoint Endpoint, req *http.Request) *Fault {
+	r := Request{Endpoint: endpoint, Query: req.URL.Query(), Time: time.Now()}
+	var namespaces []string
+	if endpoint == EndpointNotifications {
+		r.AppID, r.Cluster = r.Query.Get("appId"), r.Query.Get("cluster")
+		var notifications []notification
+		_ = json.Unmarshal([]byte(r.Query.Get("notifications")), &notifications)
+		for _, n := range notifications {
+			namespaces = append(namespaces, n.NamespaceName)
+		}
+	} else {
+		strs := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		if endpoint == EndpointConfigFiles {
+			strs = strs[1:]
+		}
+		if len(strs) == 4 {
+			r.AppID, r.Cluster, r.Namespace = strs[1], strs[2], strs[3]
+		}
+		namespaces = []string{r.Namespace}
+	}
+
+	in.lock.Lock()
+	defer in.lock.Unlock()
+
+	in.requests = append(in.requests, r)
+	for _, f := range in.faults {
+		if !f.matches(endpoint, namespaces) {
+			continue
+		}
+		if f.Times > 0 {
+			f.remaining--
+			if f.remaining <= 0 {
+				in.removeFault(f)
+			}
+		}
+		ret := f.Fault
+		return &ret
+	}
+	return nil
+}
+
+func (f *fault) matches(endpoint Endpoint, namespaces []string) bool {
+	if f.Endpoint != "" && f.Endpoint != endpoint {
+		return false
+	}
+	if f.Namespace == "" {
+		return true
+	}
+	for _, namespace := range namespaces {
+		if namespace == f.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler serve handler at endpoint, with requests recorded and faults applied
+func (in *Injector) Handler(endpoint Endpoint, handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		f := in.record(endpoint, req)
+		if f == nil {
+			handler(rw, req)
+			return
+		}
+
+		if f.Latency > 0 {
+			timer := time.NewTimer(f.Latency)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		switch {
+		case f.Hang:
+			<-req.Context().Done()
+		case f.Reset:
+			if hijacker, ok := rw.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		case f.Status != 0:
+			rw.WriteHeader(f.Status)
+		case f.Truncate, f.Malformed:
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			body := rec.Body.Bytes()
+			if f.Malformed {
+				body = []byte(`{"malformed":`)
+			} else {
+				body = body[:len(body)/2]
+			}
+			for k, v := range rec.Header() {
+				rw.Header()[k] = v
+			}
+			rw.WriteHeader(rec.Code)
+			rw.Write(body)
+		default:
+			handler(rw, req)
+		}
+	}
+}
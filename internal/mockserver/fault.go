@@ -0,0 +1,40 @@
+package mockserver
+
+import (
+	"github.com/liamylian/apollo-client/internal/faults"
+)
+
+// Fault is a failure injected into requests to mock server
+type Fault = faults.Fault
+
+// Endpoints of mock server
+const (
+	EndpointNotifications = faults.EndpointNotifications
+	EndpointConfigs       = faults.EndpointConfigs
+	EndpointConfigFiles   = faults.EndpointConfigFiles
+)
+
+// Inject fault into following requests, return a func to remove it
+func Inject(f Fault) (remove func()) {
+	return getServer().faults.Inject(f)
+}
+
+// ClearFaults remove all injected faults
+func ClearFaults() {
+	getServer().faults.ClearFaults()
+}
+
+// Requests return requests received at endpoint in order, all requests if endpoint is empty
+func Requests(endpoint faults.Endpoint) []faults.Request {
+	return getServer().faults.Requests(endpoint)
+}
+
+// RequestCount return count of requests received at endpoint, all requests if endpoint is empty
+func RequestCount(endpoint faults.Endpoint) int {
+	return getServer().faults.RequestCount(endpoint)
+}
+
+// ResetRequests forget received requests
+func ResetRequests() {
+	getServer().faults.ResetRequests()
+}
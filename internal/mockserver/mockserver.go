@@ -7,6 +7,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/liamylian/apollo-client/internal/faults"
 )
 
 type notification struct {
@@ -28,6 +30,8 @@ type mockServer struct {
 	lock          sync.Mutex
 	notifications map[string]int
 	config        map[string]map[string]string
+
+	faults faults.Injector
 }
 
 func (s *mockServer) NotificationHandler(rw http.ResponseWriter, req *http.Request) {
@@ -74,11 +78,33 @@ func (s *mockServer) ConfigHandler(rw http.ResponseWriter, req *http.Request) {
 	rw.Write(bts)
 }
 
-var server *mockServer
+func (s *mockServer) ConfigFilesHandler(rw http.ResponseWriter, req *http.Request) {
+	strs := strings.Split(req.URL.Path, "/")
+	config := s.Get(strs[len(strs)-1])
+
+	bts, err := json.Marshal(config)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Write(bts)
+}
+
+var (
+	serverLock sync.Mutex
+	server     *mockServer
+)
+
+func getServer() *mockServer {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+
+	return server
+}
 
 func (s *mockServer) Set(namespace, key, value string) {
-	server.lock.Lock()
-	defer server.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
 	notificationID := s.notifications[namespace]
 	notificationID++
@@ -93,15 +119,19 @@ func (s *mockServer) Set(namespace, key, value string) {
 }
 
 func (s *mockServer) Get(namespace string) map[string]string {
-	server.lock.Lock()
-	defer server.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	return s.config[namespace]
+	var ret = map[string]string{}
+	for k, v := range s.config[namespace] {
+		ret[k] = v
+	}
+	return ret
 }
 
 func (s *mockServer) Delete(namespace, key string) {
-	server.lock.Lock()
-	defer server.lock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
 	if kv, ok := s.config[namespace]; ok {
 		delete(kv, key)
@@ -114,30 +144,34 @@ func (s *mockServer) Delete(namespace, key string) {
 
 // Set namespace's key value
 func Set(namespace, key, value string) {
-	server.Set(namespace, key, value)
+	getServer().Set(namespace, key, value)
 }
 
 // Delete namespace's key
 func Delete(namespace, key string) {
-	server.Delete(namespace, key)
+	getServer().Delete(namespace, key)
 }
 
 // Run mock server
 func Run() error {
-	initServer()
-	return server.server.ListenAndServe()
+	return initServer().server.ListenAndServe()
 }
 
-func initServer() {
+func initServer() *mockServer {
+	serverLock.Lock()
+	defer serverLock.Unlock()
+
 	server = &mockServer{
 		notifications: map[string]int{},
 		config:        map[string]map[string]string{},
 	}
 	mux := http.NewServeMux()
-	mux.Handle("/notifications/", http.HandlerFunc(server.NotificationHandler))
-	mux.Handle("/configs/", http.HandlerFunc(server.ConfigHandler))
+	mux.Handle("/notifications/", server.faults.Handler(EndpointNotifications, server.NotificationHandler))
+	mux.Handle("/configs/", server.faults.Handler(EndpointConfigs, server.ConfigHandler))
+	mux.Handle("/configfiles/json/", server.faults.Handler(EndpointConfigFiles, server.ConfigFilesHandler))
 	server.server.Handler = mux
 	server.server.Addr = ":8080"
+	return server
 }
 
 // Close mock server
@@ -145,5 +179,9 @@ func Close() error {
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second))
 	defer cancel()
 
-	return server.server.Shutdown(ctx)
+	s := getServer()
+	if s == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
 }
@@ -0,0 +1,432 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type portalApp struct {
+	Name  string `json:"name"`
+	AppID string `json:"appId"`
+}
+
+type portalItem struct {
+	Key                      string `json:"key"`
+	Value                    string `json:"value"`
+	Comment                  string `json:"comment,omitempty"`
+	DataChangeCreatedBy      string `json:"dataChangeCreatedBy,omitempty"`
+	DataChangeLastModifiedBy string `json:"dataChangeLastModifiedBy,omitempty"`
+}
+
+type portalNamespace struct {
+	AppID         string        `json:"appId"`
+	ClusterName   string        `json:"clusterName"`
+	NamespaceName string        `json:"namespaceName"`
+	Format        string        `json:"format"`
+	IsPublic      bool          `json:"isPublic"`
+	Items         []*portalItem `json:"items"`
+
+	env       string
+	releases  []*portalRelease
+	histories []*portalHistory
+}
+
+type portalRelease struct {
+	ID             int64             `json:"id"`
+	AppID          string            `json:"appId"`
+	ClusterName    string            `json:"clusterName"`
+	NamespaceName  string            `json:"namespaceName"`
+	Name           string            `json:"name"`
+	Configurations map[string]string `json:"configurations"`
+	Comment        string            `json:"comment,omitempty"`
+	CreatedBy      string            `json:"dataChangeCreatedBy,omitempty"`
+
+	abandoned bool
+	namespace *portalNamespace
+}
+
+type portalHistory struct {
+	ID                int64  `json:"id"`
+	ReleaseID         int64  `json:"releaseId"`
+	PreviousReleaseID int64  `json:"previousReleaseId"`
+	Operation         int    `json:"operation"`
+	Operator          string `json:"dataChangeCreatedBy"`
+	CreatedTime       string `json:"dataChangeCreatedTime"`
+}
+
+type portalError struct {
+	Status    int    `json:"status"`
+	Exception string `json:"exception"`
+	Message   string `json:"message"`
+}
+
+// Portal is an in-memory Apollo portal serving Open API, for tests
+type Portal struct {
+	token string
+
+	lock       sync.Mutex
+	apps       map[string]*portalApp
+	namespaces map[string]*portalNamespace
+	releases   map[int64]*portalRelease
+	seq        int64
+}
+
+// NewPortal create portal accepting token
+func NewPortal(token string) *Portal {
+	return &Portal{
+		token:      token,
+		apps:       map[string]*portalApp{},
+		namespaces: map[string]*portalNamespace{},
+		releases:   map[int64]*portalRelease{},
+	}
+}
+
+// AddNamespace create app, cluster and namespace if not exist
+func (p *Portal) AddNamespace(env, appID, cluster, namespace string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.apps[appID]; !ok {
+		p.apps[appID] = &portalApp{Name: appID, AppID: appID}
+	}
+	key := namespaceKey(env, appID, cluster, namespace)
+	if _, ok := p.namespaces[key]; !ok {
+		p.namespaces[key] = &portalNamespace{
+			AppID:         appID,
+			ClusterName:   cluster,
+			NamespaceName: namespace,
+			Format:        "properties",
+			Items:         []*portalItem{},
+			env:           env,
+		}
+	}
+}
+
+// Released return a copy of configurations of the active release of namespace
+func (p *Portal) Released(env, appID, cluster, namespace string) map[string]string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ns, ok := p.namespaces[namespaceKey(env, appID, cluster, namespace)]
+	if !ok {
+		return nil
+	}
+	release := ns.latest()
+	if release == nil {
+		return nil
+	}
+	configurations := make(map[string]string, len(release.Configurations))
+	for key, value := range release.Configurations {
+		configurations[key] = value
+	}
+	return configurations
+}
+
+func namespaceKey(env, appID, cluster, namespace string) string {
+	return strings.Join([]string{env, appID, cluster, namespace}, "+")
+}
+
+func (n *portalNamespace) latest() *portalRelease {
+	for i := len(n.releases) - 1; i >= 0; i-- {
+		if !n.releases[i].abandoned {
+			return n.releases[i]
+		}
+	}
+	return nil
+}
+
+func (n *portalNamespace) item(key string) (int, *portalItem) {
+	for i, item := range n.Items {
+		if item.Key == key {
+			return i, item
+		}
+	}
+	return -1, nil
+}
+
+func (p *Portal) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != p.token {
+		writeError(rw, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	req.ParseForm()
+	strs := strings.Split(strings.TrimPrefix(req.URL.Path, "/openapi/v1/"), "/")
+	switch {
+	case len(strs) == 1 && strs[0] == "apps":
+		p.listApps(rw, req)
+	case len(strs) == 3 && strs[0] == "apps" && strs[2] == "envclusters":
+		p.listEnvClusters(rw, strs[1])
+	case len(strs) == 5 && strs[0] == "envs" && strs[2] == "releases" && strs[4] == "rollback":
+		p.rollback(rw, req, strs[3])
+	case len(strs) >= 7 && strs[0] == "envs" && strs[2] == "apps" && strs[4] == "clusters" && strs[6] == "namespaces":
+		p.serveNamespaces(rw, req, strs[1], strs[3], strs[5], strs[7:])
+	default:
+		writeError(rw, http.StatusNotFound, "not found")
+	}
+}
+
+func (p *Portal) listApps(rw http.ResponseWriter, req *http.Request) {
+	var ids []string
+	if appIDs := req.FormValue("appIds"); appIDs != "" {
+		ids = strings.Split(appIDs, ",")
+	} else {
+		for id := range p.apps {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	apps := []*portalApp{}
+	for _, id := range ids {
+		if app, ok := p.apps[id]; ok {
+			apps = append(apps, app)
+		}
+	}
+	writeJSON(rw, apps)
+}
+
+func (p *Portal) listEnvClusters(rw http.ResponseWriter, appID string) {
+	clusters := map[string]map[string]bool{}
+	for _, ns := range p.namespaces {
+		if ns.AppID != appID {
+			continue
+		}
+		if clusters[ns.env] == nil {
+			clusters[ns.env] = map[string]bool{}
+		}
+		clusters[ns.env][ns.ClusterName] = true
+	}
+
+	type envClusters struct {
+		Env      string   `json:"env"`
+		Clusters []string `json:"clusters"`
+	}
+	ret := []*envClusters{}
+	for env, set := range clusters {
+		ec := &envClusters{Env: env}
+		for cluster := range set {
+			ec.Clusters = append(ec.Clusters, cluster)
+		}
+		sort.Strings(ec.Clusters)
+		ret = append(ret, ec)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Env < ret[j].Env })
+	writeJSON(rw, ret)
+}
+
+func (p *Portal) serveNamespaces(rw http.ResponseWriter, req *http.Request, env, appID, cluster string, strs []string) {
+	if len(strs) == 0 {
+		ret := []*portalNamespace{}
+		for _, ns := range p.namespaces {
+			if ns.env == env && ns.AppID == appID && ns.ClusterName == cluster {
+				ret = append(ret, ns)
+			}
+		}
+		sort.Slice(ret, func(i, j int) bool { return ret[i].NamespaceName < ret[j].NamespaceName })
+		writeJSON(rw, ret)
+		return
+	}
+
+	ns, ok := p.namespaces[namespaceKey(env, appID, cluster, strs[0])]
+	if !ok {
+		writeError(rw, http.StatusNotFound, "namespace not found")
+		return
+	}
+
+	switch {
+	case len(strs) == 1 && req.Method == http.MethodGet:
+		writeJSON(rw, ns)
+	case len(strs) == 2 && strs[1] == "items" && req.Method == http.MethodPost:
+		p.createItem(rw, req, ns)
+	case len(strs) == 3 && strs[1] == "items" && req.Method == http.MethodPut:
+		p.updateItem(rw, req, ns, strs[2])
+	case len(strs) == 3 && strs[1] == "items" && req.Method == http.MethodDelete:
+		p.deleteItem(rw, req, ns, strs[2])
+	case len(strs) == 2 && strs[1] == "releases" && req.Method == http.MethodPost:
+		p.publish(rw, req, ns)
+	case len(strs) == 3 && strs[1] == "releases" && strs[2] == "latest":
+		if release := ns.latest(); release != nil {
+			writeJSON(rw, release)
+			return
+		}
+		writeError(rw, http.StatusNotFound, "release not found")
+	case len(strs) == 3 && strs[1] == "releases" && strs[2] == "histories":
+		p.histories(rw, req, ns)
+	default:
+		writeError(rw, http.StatusNotFound, "not found")
+	}
+}
+
+func (p *Portal) createItem(rw http.ResponseWriter, req *http.Request, ns *portalNamespace) {
+	var item portalItem
+	if err := json.NewDecoder(req.Body).Decode(&item); err != nil || item.Key == "" {
+		writeError(rw, http.StatusBadRequest, "invalid item")
+		return
+	}
+	if item.DataChangeCreatedBy == "" {
+		writeError(rw, http.StatusBadRequest, "dataChangeCreatedBy is required")
+		return
+	}
+	if _, exists := ns.item(item.Key); exists != nil {
+		writeError(rw, http.StatusBadRequest, "item already exists")
+		return
+	}
+	item.DataChangeLastModifiedBy = item.DataChangeCreatedBy
+	ns.Items = append(ns.Items, &item)
+	writeJSON(rw, &item)
+}
+
+func (p *Portal) updateItem(rw http.ResponseWriter, req *http.Request, ns *portalNamespace, key string) {
+	var item portalItem
+	if err := json.NewDecoder(req.Body).Decode(&item); err != nil || item.Key != key {
+		writeError(rw, http.StatusBadRequest, "invalid item")
+		return
+	}
+	if item.DataChangeLastModifiedBy == "" {
+		writeError(rw, http.StatusBadRequest, "dataChangeLastModifiedBy is required")
+		return
+	}
+	_, exists := ns.item(key)
+	switch {
+	case exists != nil:
+		exists.Value = item.Value
+		exists.Comment = item.Comment
+		exists.DataChangeLastModifiedBy = item.DataChangeLastModifiedBy
+	case req.FormValue("createIfNotExists") == "true":
+		ns.Items = append(ns.Items, &item)
+	default:
+		writeError(rw, http.StatusNotFound, "item not found")
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+func (p *Portal) deleteItem(rw http.ResponseWriter, req *http.Request, ns *portalNamespace, key string) {
+	if req.FormValue("operator") == "" {
+		writeError(rw, http.StatusBadRequest, "operator is required")
+		return
+	}
+	i, exists := ns.item(key)
+	if exists == nil {
+		writeError(rw, http.StatusNotFound, "item not found")
+		return
+	}
+	ns.Items = append(ns.Items[:i], ns.Items[i+1:]...)
+	rw.WriteHeader(http.StatusOK)
+}
+
+func (p *Portal) publish(rw http.ResponseWriter, req *http.Request, ns *portalNamespace) {
+	var body struct {
+		Title      string `json:"releaseTitle"`
+		Comment    string `json:"releaseComment"`
+		ReleasedBy string `json:"releasedBy"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Title == "" || body.ReleasedBy == "" {
+		writeError(rw, http.StatusBadRequest, "releaseTitle and releasedBy are required")
+		return
+	}
+
+	configurations := map[string]string{}
+	for _, item := range ns.Items {
+		configurations[item.Key] = item.Value
+	}
+	var previous int64
+	if latest := ns.latest(); latest != nil {
+		previous = latest.ID
+	}
+
+	p.seq++
+	release := &portalRelease{
+		ID:             p.seq,
+		AppID:          ns.AppID,
+		ClusterName:    ns.ClusterName,
+		NamespaceName:  ns.NamespaceName,
+		Name:           body.Title,
+		Configurations: configurations,
+		Comment:        body.Comment,
+		CreatedBy:      body.ReleasedBy,
+		namespace:      ns,
+	}
+	p.releases[release.ID] = release
+	ns.releases = append(ns.releases, release)
+	p.addHistory(ns, release.ID, previous, 0, body.ReleasedBy)
+	writeJSON(rw, release)
+}
+
+func (p *Portal) rollback(rw http.ResponseWriter, req *http.Request, id string) {
+	releaseID, _ := strconv.ParseInt(id, 10, 64)
+	release, ok := p.releases[releaseID]
+	if !ok {
+		writeError(rw, http.StatusNotFound, "release not found")
+		return
+	}
+	if req.FormValue("operator") == "" {
+		writeError(rw, http.StatusBadRequest, "operator is required")
+		return
+	}
+	ns := release.namespace
+	if release.abandoned || ns.latest() != release {
+		writeError(rw, http.StatusBadRequest, "release is not active")
+		return
+	}
+
+	release.abandoned = true
+	var previous int64
+	if latest := ns.latest(); latest != nil {
+		previous = latest.ID
+	}
+	p.addHistory(ns, previous, release.ID, 1, req.FormValue("operator"))
+	rw.WriteHeader(http.StatusOK)
+}
+
+func (p *Portal) addHistory(ns *portalNamespace, releaseID, previousReleaseID int64, operation int, operator string) {
+	p.seq++
+	ns.histories = append(ns.histories, &portalHistory{
+		ID:                p.seq,
+		ReleaseID:         releaseID,
+		PreviousReleaseID: previousReleaseID,
+		Operation:         operation,
+		Operator:          operator,
+		CreatedTime:       time.Now().Format("2006-01-02T15:04:05.000-0700"),
+	})
+}
+
+func (p *Portal) histories(rw http.ResponseWriter, req *http.Request, ns *portalNamespace) {
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	size, _ := strconv.Atoi(req.FormValue("size"))
+	if size <= 0 {
+		size = 10
+	}
+
+	ret := []*portalHistory{}
+	for i := len(ns.histories) - 1 - page*size; i >= 0 && len(ret) < size; i-- {
+		ret = append(ret, ns.histories[i])
+	}
+	writeJSON(rw, ret)
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	rw.Write(bts)
+}
+
+func writeError(rw http.ResponseWriter, status int, message string) {
+	rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	rw.WriteHeader(status)
+	bts, _ := json.Marshal(&portalError{Status: status, Exception: http.StatusText(status), Message: message})
+	rw.Write(bts)
+}
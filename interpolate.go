@@ -0,0 +1,125 @@
+package apollo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	placeholderPrefix = "${"
+	placeholderSuffix = "}"
+	envPlaceholder    = "env:"
+	envDefaultSep     = ":-"
+	namespaceSep      = ":"
+)
+
+// CycleError returned when placeholders reference each other in a cycle
+type CycleError struct {
+	// Path of references, in the form of namespace:key, the last one equals to the first one
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("placeholder cycle: %s", strings.Join(e.Path, " -> "))
+}
+
+// lookupFunc return raw value of key in namespace
+type lookupFunc func(namespace, key string) (string, bool)
+
+// interpolator resolve ${key}, ${namespace:key} and ${env:VAR:-default} in values
+type interpolator struct {
+	lookup  lookupFunc
+	decrypt func(value string) (string, error)
+	// placeholder enable placeholder expansion, otherwise values are only decrypted
+	placeholder bool
+}
+
+// resolve value of key in namespace, report whether key exists
+func (i *interpolator) resolve(namespace, key string) (string, bool, error) {
+	return i.resolveRef(namespace, key, nil)
+}
+
+func (i *interpolator) resolveRef(namespace, key string, visiting []string) (string, bool, error) {
+	ref := namespace + namespaceSep + key
+	for n, v := range visiting {
+		if v == ref {
+			path := append(append([]string{}, visiting[n:]...), ref)
+			return "", false, &CycleError{Path: path}
+		}
+	}
+
+	raw, ok := i.lookup(namespace, key)
+	if !ok {
+		return "", false, nil
+	}
+
+	// ciphertext never contains placeholders
+	if plaintext, err := i.decrypt(raw); err != nil || plaintext != raw || !i.placeholder {
+		return plaintext, true, err
+	}
+
+	val, err := i.expand(namespace, raw, append(visiting, ref))
+	return val, true, err
+}
+
+// expand all placeholders in value, unresolvable placeholders are kept as they are
+func (i *interpolator) expand(namespace, value string, visiting []string) (string, error) {
+	if !strings.Contains(value, placeholderPrefix) {
+		return value, nil
+	}
+
+	var buf strings.Builder
+	for {
+		start := strings.Index(value, placeholderPrefix)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], placeholderSuffix)
+		if end < 0 {
+			break
+		}
+		end += start
+
+		buf.WriteString(value[:start])
+		placeholder := value[start : end+len(placeholderSuffix)]
+		resolved, ok, err := i.resolvePlaceholder(namespace, value[start+len(placeholderPrefix):end], visiting)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			buf.WriteString(resolved)
+		} else {
+			buf.WriteString(placeholder)
+		}
+		value = value[end+len(placeholderSuffix):]
+	}
+	buf.WriteString(value)
+
+	return buf.String(), nil
+}
+
+func (i *interpolator) resolvePlaceholder(namespace, ref string, visiting []string) (string, bool, error) {
+	if strings.HasPrefix(ref, envPlaceholder) {
+		name, defaultValue := ref[len(envPlaceholder):], ""
+		hasDefault := false
+		if n := strings.Index(name, envDefaultSep); n >= 0 {
+			name, defaultValue, hasDefault = name[:n], name[n+len(envDefaultSep):], true
+		}
+		if val := os.Getenv(name); val != "" {
+			return val, true, nil
+		}
+		return defaultValue, hasDefault, nil
+	}
+
+	key := ref
+	if n := strings.Index(ref, namespaceSep); n >= 0 {
+		namespace, key = ref[:n], ref[n+len(namespaceSep):]
+	}
+	return i.resolveRef(namespace, key, visiting)
+}
+
+// hasPlaceholder report whether value may reference other values
+func hasPlaceholder(value string) bool {
+	return strings.Contains(value, placeholderPrefix)
+}
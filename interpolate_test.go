@@ -0,0 +1,126 @@
+package apollo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolator(t *testing.T) {
+	kv := map[string]map[string]string{
+		"application": {
+			"host":    "example.com",
+			"base":    "https://${host}",
+			"api":     "${base}/api",
+			"common":  "${TEAM.common:timeout}s",
+			"port":    "${env:APOLLO_TEST_PORT:-8080}",
+			"user":    "${env:APOLLO_TEST_USER}",
+			"missing": "${nothing}",
+			"a":       "${b}",
+			"b":       "${a}",
+		},
+		"TEAM.common": {
+			"timeout": "30",
+		},
+	}
+	i := &interpolator{
+		lookup: func(namespace, key string) (string, bool) {
+			val, ok := kv[namespace][key]
+			return val, ok
+		},
+		decrypt:     func(value string) (string, error) { return value, nil },
+		placeholder: true,
+	}
+	os.Setenv("APOLLO_TEST_USER", "apollo")
+	defer os.Unsetenv("APOLLO_TEST_USER")
+
+	var tcs = []struct {
+		key  string
+		want string
+	}{
+		{"base", "https://example.com"},
+		{"api", "https://example.com/api"},
+		{"common", "30s"},
+		{"port", "8080"},
+		{"user", "apollo"},
+		{"missing", "${nothing}"},
+	}
+	for _, tc := range tcs {
+		val, ok, err := i.resolve("application", tc.key)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, tc.want, val, tc.key)
+	}
+
+	_, _, err := i.resolve("application", "a")
+	assert.Equal(t, &CycleError{Path: []string{"application:a", "application:b", "application:a"}}, err)
+
+	_, ok, err := i.resolve("application", "null")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	i.placeholder = false
+	val, _, _ := i.resolve("application", "base")
+	assert.Equal(t, "https://${host}", val)
+}
+
+func TestClientDerivedChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, EnablePlaceholder: true})
+	client.handleResult(&result{
+		NamespaceName:  "TEAM.common",
+		Configurations: map[string]string{"host": "example.com"},
+	})
+	client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"base": "https://${TEAM.common:host}", "api": "${base}/api"},
+	})
+	assert.Equal(t, "https://example.com/api", client.GetStringValue("api", ""))
+
+	events := client.handleResult(&result{
+		NamespaceName:  "TEAM.common",
+		Configurations: map[string]string{"host": "apollo.io"},
+	})
+	assert.Len(t, events, 2)
+	assert.Equal(t, "TEAM.common", events[0].Namespace)
+	assert.Equal(t, makeModifyChange("host", "example.com", "apollo.io"), events[0].Changes["host"])
+	assert.Equal(t, defaultNamespace, events[1].Namespace)
+	assert.Equal(t, &Change{
+		OldValue:   "https://example.com/api",
+		NewValue:   "https://apollo.io/api",
+		ChangeType: MODIFY,
+		Derived:    true,
+	}, events[1].Changes["api"])
+	assert.True(t, events[1].Changes["base"].Derived)
+
+	// derived events are ordered by namespace
+	client.handleResult(&result{
+		NamespaceName:  "TEAM.other",
+		Configurations: map[string]string{"url": "${TEAM.common:host}"},
+	})
+	client.handleResult(&result{
+		NamespaceName:  "TEAM.another",
+		Configurations: map[string]string{"url": "${TEAM.common:host}"},
+	})
+	for i := 0; i < 5; i++ {
+		events = client.handleResult(&result{
+			NamespaceName:  "TEAM.common",
+			Configurations: map[string]string{"host": fmt.Sprint("host", i)},
+		})
+		assert.Len(t, events, 4)
+		assert.Equal(t, []string{"TEAM.common", "TEAM.another", "TEAM.other", defaultNamespace},
+			[]string{events[0].Namespace, events[1].Namespace, events[2].Namespace, events[3].Namespace})
+	}
+
+	client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"api": "${api}"},
+	})
+	assert.Equal(t, "default", client.GetStringValue("api", "default"))
+}
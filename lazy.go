@@ -0,0 +1,153 @@
+package apollo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// negativeCacheTTL is how long a not found namespace is remembered in lazy load mode
+	negativeCacheTTL = time.Minute
+	// failureBackoff is how long a namespace failed to load for other errors is
+	// not loaded again, so reads don't each wait for a fetch during an outage
+	failureBackoff = 5 * time.Second
+)
+
+// ErrNamespaceNotFound returned when lazy loading a namespace not exist
+var ErrNamespaceNotFound = errors.New("namespace not found")
+
+// lazyLoader load unknown namespaces on first read, concurrent loads of the
+// same namespace are deduplicated, and failed loads are remembered for a while
+type lazyLoader struct {
+	notFoundTTL time.Duration
+	backoff     time.Duration
+
+	lock    sync.Mutex
+	loading map[string]*lazyLoad
+	failed  map[string]*lazyFailure
+}
+
+// lazyFailure is a failed load returned again until expire
+type lazyFailure struct {
+	err    error
+	expire time.Time
+}
+
+// lazyLoad is an in-flight load of a namespace
+type lazyLoad struct {
+	done chan struct{}
+	err  error
+}
+
+func newLazyLoader() *lazyLoader {
+	return &lazyLoader{
+		notFoundTTL: negativeCacheTTL,
+		backoff:     failureBackoff,
+		loading:     map[string]*lazyLoad{},
+		failed:      map[string]*lazyFailure{},
+	}
+}
+
+// load namespace with fn, callers loading the same namespace at the same time share one call
+func (l *lazyLoader) load(namespace string, fn func() error) error {
+	l.lock.Lock()
+	if failure, ok := l.failed[namespace]; ok {
+		if time.Now().Before(failure.expire) {
+			l.lock.Unlock()
+			return failure.err
+		}
+		delete(l.failed, namespace)
+	}
+	if call, ok := l.loading[namespace]; ok {
+		l.lock.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &lazyLoad{done: make(chan struct{})}
+	l.loading[namespace] = call
+	l.lock.Unlock()
+
+	call.err = fn()
+
+	l.lock.Lock()
+	delete(l.loading, namespace)
+	if call.err != nil {
+		l.fail(namespace, call.err)
+	}
+	l.lock.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// fail remember failure of namespace, expired failures of others are swept so
+// failed is bounded by namespaces failed recently
+func (l *lazyLoader) fail(namespace string, err error) {
+	now := time.Now()
+	for ns, failure := range l.failed {
+		if !now.Before(failure.expire) {
+			delete(l.failed, ns)
+		}
+	}
+
+	ttl := l.backoff
+	if err == ErrNamespaceNotFound {
+		ttl = l.notFoundTTL
+	}
+	l.failed[namespace] = &lazyFailure{err: err, expire: now.Add(ttl)}
+}
+
+// ensureNamespace load namespace on first read in lazy load mode
+func (c *Client) ensureNamespace(namespace string) error {
+	if !c.conf.LazyLoad {
+		return nil
+	}
+	if _, ok := c.caches.getCache(namespace); ok {
+		return nil
+	}
+	return c.lazyLoader.load(namespace, func() error {
+		return c.loadNamespace(namespace)
+	})
+}
+
+// loadNamespace fetch namespace synchronously with a timeout. It's registered to
+// long polling before fetching, so updates released meanwhile are not missed, and
+// an unsubscribe during the fetch wins.
+func (c *Client) loadNamespace(namespace string) error {
+	// loaded by another caller just now
+	if _, ok := c.caches.getCache(namespace); ok {
+		return nil
+	}
+
+	registered := c.longPoller.registerNamespace(namespace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.conf.lazyLoadTimeout())
+	defer cancel()
+
+	result, err := c.fetch(ctx, namespace)
+	if err != nil {
+		if registered {
+			c.longPoller.unregisterNamespace(namespace)
+		}
+		if err == ErrorStatusNotFound {
+			return ErrNamespaceNotFound
+		}
+		return err
+	}
+
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	// unsubscribed while fetching
+	if !c.longPoller.hasNamespace(namespace) {
+		return nil
+	}
+	if result != nil {
+		c.publish(c.handleResult(result))
+	}
+	// remember empty namespace as loaded too
+	c.mustGetCache(namespace)
+	return nil
+}
@@ -0,0 +1,142 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRequester serve config requests from memory and count them per namespace
+type fakeRequester struct {
+	lock    sync.Mutex
+	delay   time.Duration
+	configs map[string]map[string]string
+	counts  map[string]int
+	// fails is count of config requests to fail
+	fails int
+}
+
+func (r *fakeRequester) serve(ctx context.Context, url string) ([]byte, error) {
+	// long poll holds as nothing is released
+	if strings.Contains(url, "/notifications/") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	namespace := strings.Split(url[strings.Index(url, "/configs/"):], "/")[4]
+	namespace = namespace[:strings.Index(namespace, "?")]
+
+	r.lock.Lock()
+	r.counts[namespace]++
+	configs, ok := r.configs[namespace]
+	fail := r.fails > 0
+	if fail {
+		r.fails--
+	}
+	r.lock.Unlock()
+
+	if fail {
+		return nil, ErrorStatusNotOK
+	}
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !ok {
+		return nil, ErrorStatusNotFound
+	}
+	return json.Marshal(&result{NamespaceName: namespace, Configurations: configs, ReleaseKey: "release-1"})
+}
+
+func (r *fakeRequester) count(namespace string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.counts[namespace]
+}
+
+func TestClientLazyLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	requester := &fakeRequester{
+		delay:   50 * time.Millisecond,
+		configs: map[string]map[string]string{"lazy": {"key": "value"}},
+		counts:  map[string]int{},
+	}
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, LazyLoad: true})
+	client.requester = requesterFunc(requester.serve)
+	client.longPoller.(*longPoller).requester = requesterFunc(requester.serve)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "value", client.GetStringValueWithNameSpace("lazy", "key", "default"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, requester.count("lazy"))
+	assert.Equal(t, []string{"key"}, client.GetAllKeys("lazy"))
+	assert.Equal(t, 1, requester.count("lazy"))
+	_, ok := client.longPoller.(*longPoller).notifications.getNotificationID("lazy")
+	assert.True(t, ok)
+
+	// not found namespace is negative cached
+	assert.Equal(t, "default", client.GetStringValueWithNameSpace("missing", "key", "default"))
+	assert.Nil(t, client.GetAllKeys("missing"))
+	assert.Equal(t, 1, requester.count("missing"))
+	_, ok = client.longPoller.(*longPoller).notifications.getNotificationID("missing")
+	assert.False(t, ok)
+
+	// fetch timeout
+	client.conf.LazyLoadTimeoutMs = 10
+	requester.lock.Lock()
+	requester.configs["slow"] = map[string]string{"key": "value"}
+	requester.lock.Unlock()
+	start := time.Now()
+	assert.Equal(t, "default", client.GetStringValueWithNameSpace("slow", "key", "default"))
+	assert.True(t, time.Since(start) < 40*time.Millisecond, time.Since(start).String())
+
+	// lazy load disabled
+	client.conf.LazyLoad = false
+	assert.Equal(t, "default", client.GetStringValueWithNameSpace("other", "key", "default"))
+	assert.Equal(t, 0, requester.count("other"))
+}
+
+func TestLazyLoaderBackoff(t *testing.T) {
+	l := newLazyLoader()
+	l.backoff = 20 * time.Millisecond
+	l.notFoundTTL = 20 * time.Millisecond
+
+	var calls int
+	fail := func() error {
+		calls++
+		return ErrorStatusNotOK
+	}
+
+	// failure is returned without loading again during backoff
+	assert.Equal(t, ErrorStatusNotOK, l.load("down", fail))
+	assert.Equal(t, ErrorStatusNotOK, l.load("down", fail))
+	assert.Equal(t, 1, calls)
+
+	// expired failures are swept when another one is remembered
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, ErrNamespaceNotFound, l.load("missing", func() error { return ErrNamespaceNotFound }))
+	l.lock.Lock()
+	_, ok := l.failed["down"]
+	assert.False(t, ok)
+	assert.Len(t, l.failed, 1)
+	l.lock.Unlock()
+
+	assert.Equal(t, ErrorStatusNotOK, l.load("down", fail))
+	assert.Equal(t, 2, calls)
+}
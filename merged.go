@@ -0,0 +1,230 @@
+package apollo
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MergedView is a read only view over an ordered list of namespaces, such as an
+// app namespace over associated public namespaces. A key is read from the first
+// namespace that has it, so a key deleted in an override namespace falls through
+// to the public value.
+type MergedView struct {
+	client     *Client
+	namespaces []string
+
+	lock     sync.Mutex
+	snapshot map[string]string
+
+	dispatcher     *dispatcher
+	removeListener func()
+	updateLock     sync.Mutex
+	updateSub      *Subscription
+	closeOnce      sync.Once
+}
+
+// NewMergedView subscribe to namespaces and create a merged view over them,
+// namespaces are ordered from the highest priority to the lowest
+func (c *Client) NewMergedView(namespaces ...string) (*MergedView, error) {
+	if err := c.SubscribeToNamespaces(namespaces...); err != nil {
+		return nil, err
+	}
+
+	// merge can't lazy load under syncLock, load namespaces missed by a failed fetch first
+	for _, namespace := range namespaces {
+		if err := c.ensureNamespace(namespace); err != nil {
+			log.Printf("[apollo] err load namespace %s: %v", namespace, err)
+		}
+	}
+
+	view := &MergedView{
+		client:     c,
+		namespaces: namespaces,
+		dispatcher: newDispatcher(),
+	}
+	c.syncLock.Lock()
+	view.snapshot = view.merge()
+	view.removeListener = c.addListener(view.handleChange)
+	c.addDispatcher(view.dispatcher)
+	c.syncLock.Unlock()
+
+	return view, nil
+}
+
+// Name of view, which is the namespaces joined by comma
+func (v *MergedView) Name() string {
+	return strings.Join(v.namespaces, ",")
+}
+
+// Namespaces of view, ordered from the highest priority to the lowest
+func (v *MergedView) Namespaces() []string {
+	return append([]string{}, v.namespaces...)
+}
+
+// Get value of key from the first namespace has it
+func (v *MergedView) Get(key, defaultValue string) string {
+	if val, ok := v.resolve(v.client.newInterpolator(v.client.lookup), key); ok {
+		return val
+	}
+	return defaultValue
+}
+
+// resolve key from the first namespace has it. Like Client.GetStringValueWithNameSpace,
+// a value can't be resolved or empty hides the key, instead of falling through
+// to namespaces of lower priority. Get, GetAllKeys and events share the rule.
+func (v *MergedView) resolve(interpolator *interpolator, key string) (string, bool) {
+	for _, namespace := range v.namespaces {
+		val, ok, err := interpolator.resolve(namespace, key)
+		if err != nil {
+			log.Printf("[apollo] err resolve %s of %s: %v", key, namespace, err)
+			return "", false
+		}
+		if ok {
+			return val, val != ""
+		}
+	}
+	return "", false
+}
+
+// GetAllKeys return keys of all namespaces
+func (v *MergedView) GetAllKeys() []string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	var keys []string
+	for key := range v.snapshot {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// WatchUpdate get changes of the merged result, event namespace is the view name
+func (v *MergedView) WatchUpdate() <-chan *ChangeEvent {
+	v.updateLock.Lock()
+	defer v.updateLock.Unlock()
+
+	if v.updateSub == nil {
+		v.updateSub = v.Subscribe()
+	}
+	return v.updateSub.Events()
+}
+
+// Subscribe to changes of the merged result, snapshot event contains the merged contents
+func (v *MergedView) Subscribe(opts ...SubscribeOption) *Subscription {
+	o := newSubscribeOptions(opts)
+
+	v.client.syncLock.Lock()
+	defer v.client.syncLock.Unlock()
+
+	var snapshot []*ChangeEvent
+	if o.snapshot {
+		v.lock.Lock()
+		event := &ChangeEvent{
+			Namespace:      v.Name(),
+			Changes:        diff(nil, v.snapshot),
+			AppID:          v.client.conf.AppID,
+			Cluster:        v.client.conf.Cluster,
+			NotificationID: defaultNotificationID,
+			ReceivedAt:     time.Now(),
+			Source:         SourceSnapshot,
+		}
+		v.lock.Unlock()
+		snapshot = append(snapshot, event)
+	}
+	return v.dispatcher.subscribe(o.buffer, snapshot)
+}
+
+// Close stop watching changes and close channels of subscribers, each of them
+// receives pending events first unless ctx is done. Namespaces stay subscribed.
+func (v *MergedView) Close(ctx context.Context) error {
+	var err error
+	v.closeOnce.Do(func() {
+		v.client.syncLock.Lock()
+		v.removeListener()
+		v.client.removeDispatcher(v.dispatcher)
+		v.client.syncLock.Unlock()
+
+		v.updateLock.Lock()
+		v.updateSub = nil
+		v.updateLock.Unlock()
+
+		err = v.dispatcher.close(ctx)
+	})
+	return err
+}
+
+// merge namespaces into a single kv, it runs under syncLock so only cached
+// namespaces are read
+func (v *MergedView) merge() map[string]string {
+	interpolator := v.client.newInterpolator(v.client.lookup)
+
+	var (
+		ret  = map[string]string{}
+		seen = map[string]bool{}
+	)
+	for _, namespace := range v.namespaces {
+		for _, key := range v.client.keys(namespace) {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if val, ok := v.resolve(interpolator, key); ok {
+				ret[key] = val
+			}
+		}
+	}
+	return ret
+}
+
+func (v *MergedView) handleChange(event *ChangeEvent) {
+	if !v.contains(event.Namespace) {
+		return
+	}
+
+	v.lock.Lock()
+	old := v.snapshot
+	v.snapshot = v.merge()
+	changes := diff(old, v.snapshot)
+	v.lock.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+
+	merged := *event
+	merged.Namespace, merged.Changes = v.Name(), changes
+	v.dispatcher.publish(&merged)
+}
+
+func (v *MergedView) contains(namespace string) bool {
+	for _, ns := range v.namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// diff generate changes from old kv to new kv
+func diff(old, new map[string]string) map[string]*Change {
+	var changes = map[string]*Change{}
+	for k, v := range old {
+		if _, ok := new[k]; !ok {
+			changes[k] = makeDeleteChange(k, v)
+		}
+	}
+	for k, v := range new {
+		oldValue, ok := old[k]
+		if !ok {
+			changes[k] = makeAddChange(k, v)
+			continue
+		}
+		if oldValue != v {
+			changes[k] = makeModifyChange(k, oldValue, v)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,180 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergedView(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, IP: "127.0.0.1:1"})
+	apply := func(r *result) {
+		for _, event := range client.handleResult(r) {
+			client.notifyListeners(event)
+		}
+	}
+	apply(&result{
+		NamespaceName:  "TEAM.common",
+		Configurations: map[string]string{"timeout": "30", "host": "common.example.com"},
+	})
+	apply(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"host": "app.example.com"},
+	})
+
+	view, err := client.NewMergedView(defaultNamespace, "TEAM.common")
+	assert.Nil(t, err)
+	updates := view.WatchUpdate()
+	sub := view.Subscribe(WithSnapshot())
+	defer sub.Close()
+	snapshot := <-sub.Events()
+	assert.Equal(t, SourceSnapshot, snapshot.Source)
+	assert.Equal(t, map[string]*Change{
+		"host":    makeAddChange("host", "app.example.com"),
+		"timeout": makeAddChange("timeout", "30"),
+	}, snapshot.Changes)
+	assert.Equal(t, "application,TEAM.common", view.Name())
+	assert.Equal(t, "app.example.com", view.Get("host", ""))
+	assert.Equal(t, "30", view.Get("timeout", ""))
+	assert.Equal(t, "default", view.Get("null", "default"))
+
+	keys := view.GetAllKeys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"host", "timeout"}, keys)
+
+	// delete key in override namespace, falls through to public value
+	apply(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{},
+	})
+	assert.Equal(t, "common.example.com", view.Get("host", ""))
+	event := <-updates
+	assert.Equal(t, view.Name(), event.Namespace)
+	assert.Equal(t, map[string]*Change{
+		"host": makeModifyChange("host", "app.example.com", "common.example.com"),
+	}, event.Changes)
+
+	// change in public namespace shadowed by override produce no event
+	apply(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"timeout": "10"},
+	})
+	<-updates
+	apply(&result{
+		NamespaceName:  "TEAM.common",
+		Configurations: map[string]string{"timeout": "60", "host": "common.example.com"},
+	})
+	select {
+	case event := <-updates:
+		t.Errorf("shadowed change should not produce event, got %v", event)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestMergedViewClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, IP: "127.0.0.1:1"})
+	view, err := client.NewMergedView(defaultNamespace)
+	assert.Nil(t, err)
+	updates := view.WatchUpdate()
+	assert.Len(t, client.listeners, 1)
+	assert.Len(t, client.getDispatchers(), 2)
+
+	assert.Nil(t, view.Close(context.Background()))
+	assert.Nil(t, view.Close(context.Background()))
+	assert.Len(t, client.listeners, 0)
+	assert.Len(t, client.getDispatchers(), 1)
+	_, ok := <-updates
+	assert.False(t, ok)
+
+	// changes are not merged after close
+	client.publish(client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"timeout": "10"},
+	}))
+	assert.Equal(t, 0, len(view.GetAllKeys()))
+}
+
+func TestMergedViewLazyLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	requester := &fakeRequester{
+		configs: map[string]map[string]string{"lazy": {"key": "value"}},
+		counts:  map[string]int{},
+		fails:   1,
+	}
+	// notification of lazy is returned at once, instead of holding the poll
+	serve := func(ctx context.Context, url string) ([]byte, error) {
+		if strings.Contains(url, "/notifications/") {
+			return json.Marshal([]*notification{{NamespaceName: "lazy", NotificationID: 1}})
+		}
+		return requester.serve(ctx, url)
+	}
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, LazyLoad: true})
+	client.requester = requesterFunc(serve)
+	client.longPoller.(*longPoller).requester = requesterFunc(serve)
+
+	// the first fetch fails, so the namespace is lazy loaded, which must not
+	// happen under syncLock held by merging
+	created := make(chan *MergedView)
+	go func() {
+		view, err := client.NewMergedView("lazy")
+		assert.Nil(t, err)
+		created <- view
+	}()
+	select {
+	case view := <-created:
+		defer view.Close(context.Background())
+		assert.Equal(t, "value", view.Get("key", ""))
+		assert.Equal(t, []string{"key"}, view.GetAllKeys())
+	case <-time.After(time.Second):
+		t.Fatal("NewMergedView deadlocked")
+	}
+}
+
+func TestMergedViewFirstMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{AppID: "SampleApp", Cluster: "default", CacheDir: dir, IP: "127.0.0.1:1", EnablePlaceholder: true})
+	client.handleResult(&result{
+		NamespaceName:  "TEAM.common",
+		Configurations: map[string]string{"empty": "common", "cycle": "common", "timeout": "30"},
+	})
+	client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"empty": "", "cycle": "${cycle}"},
+	})
+
+	// empty and unresolvable values of the first namespace hide the key in
+	// Get, GetAllKeys and events alike
+	view, err := client.NewMergedView(defaultNamespace, "TEAM.common")
+	assert.Nil(t, err)
+	defer view.Close(context.Background())
+	assert.Equal(t, "default", view.Get("empty", "default"))
+	assert.Equal(t, "default", view.Get("cycle", "default"))
+	assert.Equal(t, "30", view.Get("timeout", "default"))
+	assert.Equal(t, []string{"timeout"}, view.GetAllKeys())
+
+	sub := view.Subscribe(WithSnapshot())
+	defer sub.Close()
+	snapshot := <-sub.Events()
+	assert.Equal(t, map[string]*Change{"timeout": makeAddChange("timeout", "30")}, snapshot.Changes)
+}
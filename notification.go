@@ -2,50 +2,121 @@ package apollo
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// NamespaceErrors aggregate errors of namespaces failed to update, keyed by namespace
+type NamespaceErrors map[string]error
+
+func (e NamespaceErrors) Error() string {
+	namespaces := make([]string, 0, len(e))
+	for namespace := range e {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	msgs := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", namespace, e[namespace]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
 type notification struct {
 	NamespaceName  string `json:"namespaceName,omitempty"`
 	NotificationID int    `json:"notificationId,omitempty"`
 }
 
+// notificationRepo is the set of subscribed namespaces with their notification
+// ids, it's the membership writers of namespaces check
 type notificationRepo struct {
-	notifications sync.Map
+	lock          sync.Mutex
+	notifications map[string]int
 }
 
 func (n *notificationRepo) addNotificationID(namesapce string, notificationID int) bool {
-	_, loaded := n.notifications.LoadOrStore(namesapce, notificationID)
-	return !loaded
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, ok := n.notifications[namesapce]; ok {
+		return false
+	}
+	n.set(namesapce, notificationID)
+	return true
+}
+
+// deleteNotificationID remove namespace, report whether it existed
+func (n *notificationRepo) deleteNotificationID(namespace string) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	_, ok := n.notifications[namespace]
+	delete(n.notifications, namespace)
+	return ok
 }
 
 func (n *notificationRepo) setNotificationID(namesapce string, notificationID int) {
-	n.notifications.Store(namesapce, notificationID)
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.set(namesapce, notificationID)
+}
+
+// updateNotificationID set notification id of namespace only if it's not removed
+func (n *notificationRepo) updateNotificationID(namespace string, notificationID int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, ok := n.notifications[namespace]; ok {
+		n.notifications[namespace] = notificationID
+	}
+}
+
+// resetNotificationIDs set notification ids of all namespaces to notificationID
+func (n *notificationRepo) resetNotificationIDs(notificationID int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for namespace := range n.notifications {
+		n.notifications[namespace] = notificationID
+	}
+}
+
+func (n *notificationRepo) set(namespace string, notificationID int) {
+	if n.notifications == nil {
+		n.notifications = map[string]int{}
+	}
+	n.notifications[namespace] = notificationID
 }
 
 func (n *notificationRepo) getNotificationID(namespace string) (int, bool) {
-	if val, ok := n.notifications.Load(namespace); ok {
-		if ret, ok := val.(int); ok {
-			return ret, true
-		}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if ret, ok := n.notifications[namespace]; ok {
+		return ret, true
 	}
 
 	return defaultNotificationID, false
 }
 
 func (n *notificationRepo) toString() string {
+	n.lock.Lock()
 	var notifications []*notification
-	n.notifications.Range(func(key, val interface{}) bool {
-		k, _ := key.(string)
-		v, _ := val.(int)
+	for k, v := range n.notifications {
 		notifications = append(notifications, &notification{
 			NamespaceName:  k,
 			NotificationID: v,
 		})
+	}
+	n.lock.Unlock()
 
-		return true
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].NamespaceName < notifications[j].NamespaceName
 	})
-
 	bts, err := json.Marshal(&notifications)
 	if err != nil {
 		return ""
@@ -22,4 +22,8 @@ func TestNotification(t *testing.T) {
 	if str := repo.toString(); str == "" {
 		t.FailNow()
 	}
+
+	if !repo.deleteNotificationID("namespace") || repo.deleteNotificationID("namespace") {
+		t.FailNow()
+	}
 }
@@ -0,0 +1,231 @@
+// Package openapi is a client of Apollo portal Open API, to manage and publish
+// configuration. Requests are authenticated by a token created in portal.
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = time.Second * 10
+
+// Client call Apollo portal Open API
+type Client struct {
+	addr       string
+	token      string
+	httpClient *http.Client
+}
+
+// Option configure Client
+type Option func(c *Client)
+
+// WithHTTPClient use client to send requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// NewClient create client of portal at addr with token
+func NewClient(addr, token string, opts ...Option) *Client {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	c := &Client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListApps list apps, all apps authorized to the token if appIDs is empty
+func (c *Client) ListApps(ctx context.Context, appIDs ...string) ([]*App, error) {
+	path := "/openapi/v1/apps"
+	if len(appIDs) > 0 {
+		path += "?appIds=" + url.QueryEscape(strings.Join(appIDs, ","))
+	}
+	var apps []*App
+	err := c.do(ctx, http.MethodGet, path, nil, &apps)
+	return apps, err
+}
+
+// ListEnvClusters list clusters of app in every env
+func (c *Client) ListEnvClusters(ctx context.Context, appID string) ([]*EnvClusters, error) {
+	var envClusters []*EnvClusters
+	err := c.do(ctx, http.MethodGet, "/openapi/v1/apps/"+url.PathEscape(appID)+"/envclusters", nil, &envClusters)
+	return envClusters, err
+}
+
+// ListNamespaces list namespaces with items of a cluster
+func (c *Client) ListNamespaces(ctx context.Context, env, appID, cluster string) ([]*Namespace, error) {
+	path := fmt.Sprintf("/openapi/v1/envs/%s/apps/%s/clusters/%s/namespaces",
+		url.PathEscape(env), url.PathEscape(appID), url.PathEscape(cluster))
+	var namespaces []*Namespace
+	err := c.do(ctx, http.MethodGet, path, nil, &namespaces)
+	return namespaces, err
+}
+
+// GetNamespace get a namespace with items
+func (c *Client) GetNamespace(ctx context.Context, ref NamespaceRef) (*Namespace, error) {
+	path, err := ref.path("")
+	if err != nil {
+		return nil, err
+	}
+	var namespace Namespace
+	if err := c.do(ctx, http.MethodGet, path, nil, &namespace); err != nil {
+		return nil, err
+	}
+	return &namespace, nil
+}
+
+// CreateItem create item in namespace, item.DataChangeCreatedBy is required
+func (c *Client) CreateItem(ctx context.Context, ref NamespaceRef, item *Item) (*Item, error) {
+	path, err := ref.path("/items")
+	if err != nil {
+		return nil, err
+	}
+	var created Item
+	if err := c.do(ctx, http.MethodPost, path, item, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateItem update item in namespace, item.DataChangeLastModifiedBy is required.
+// If createIfNotExists, item is created if not exists, then item.DataChangeCreatedBy
+// is required too.
+func (c *Client) UpdateItem(ctx context.Context, ref NamespaceRef, item *Item, createIfNotExists bool) error {
+	path, err := ref.path("/items/" + url.PathEscape(item.Key))
+	if err != nil {
+		return err
+	}
+	if createIfNotExists {
+		path += "?createIfNotExists=true"
+	}
+	return c.do(ctx, http.MethodPut, path, item, nil)
+}
+
+// DeleteItem delete item of key in namespace
+func (c *Client) DeleteItem(ctx context.Context, ref NamespaceRef, key, operator string) error {
+	path, err := ref.path("/items/" + url.PathEscape(key))
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodDelete, path+"?operator="+url.QueryEscape(operator), nil, nil)
+}
+
+// PublishRelease publish current items of namespace
+func (c *Client) PublishRelease(ctx context.Context, ref NamespaceRef, release *NewRelease) (*Release, error) {
+	path, err := ref.path("/releases")
+	if err != nil {
+		return nil, err
+	}
+	var published Release
+	if err := c.do(ctx, http.MethodPost, path, release, &published); err != nil {
+		return nil, err
+	}
+	return &published, nil
+}
+
+// GetLatestRelease get the active release of namespace
+func (c *Client) GetLatestRelease(ctx context.Context, ref NamespaceRef) (*Release, error) {
+	path, err := ref.path("/releases/latest")
+	if err != nil {
+		return nil, err
+	}
+	var release Release
+	if err := c.do(ctx, http.MethodGet, path, nil, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// Rollback abandon release of id, the namespace is back to the previous release
+func (c *Client) Rollback(ctx context.Context, env string, releaseID int64, operator string) error {
+	path := fmt.Sprintf("/openapi/v1/envs/%s/releases/%d/rollback?operator=%s",
+		url.PathEscape(env), releaseID, url.QueryEscape(operator))
+	return c.do(ctx, http.MethodPut, path, nil, nil)
+}
+
+// ReleaseHistory list publish and rollback records of namespace, latest first
+func (c *Client) ReleaseHistory(ctx context.Context, ref NamespaceRef, page, size int) ([]*ReleaseHistory, error) {
+	path, err := ref.path("/releases/histories")
+	if err != nil {
+		return nil, err
+	}
+	path += "?page=" + strconv.Itoa(page) + "&size=" + strconv.Itoa(size)
+	var histories []*ReleaseHistory
+	err = c.do(ctx, http.MethodGet, path, nil, &histories)
+	return histories, err
+}
+
+// path of namespace api, with suffix
+func (r NamespaceRef) path(suffix string) (string, error) {
+	if r.Env == "" || r.AppID == "" || r.Cluster == "" || r.Namespace == "" {
+		return "", ErrInvalidRef
+	}
+	return fmt.Sprintf("/openapi/v1/envs/%s/apps/%s/clusters/%s/namespaces/%s%s",
+		url.PathEscape(r.Env),
+		url.PathEscape(r.AppID),
+		url.PathEscape(r.Cluster),
+		url.PathEscape(r.Namespace),
+		suffix), nil
+}
+
+// do send request with json body in, decode json response into out if not nil
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		bts, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bts)
+	}
+
+	req, err := http.NewRequest(method, c.addr+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.token)
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// decodeError decode error body of portal, body is used as message if it's not json
+func decodeError(resp *http.Response) error {
+	bts, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &Error{}
+	if err := json.Unmarshal(bts, e); err != nil {
+		e.Message = strings.TrimSpace(string(bts))
+	}
+	e.StatusCode = resp.StatusCode
+	return e
+}
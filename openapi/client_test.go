@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/liamylian/apollo-client/internal/mockserver"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "e16e5cd903fd0c97a116c873b448544b9d086de9"
+
+func newTestClient() (*Client, *mockserver.Portal, func()) {
+	portal := mockserver.NewPortal(testToken)
+	portal.AddNamespace("DEV", "SampleApp", "default", "application")
+	portal.AddNamespace("DEV", "SampleApp", "default", "client.json")
+	portal.AddNamespace("PRO", "SampleApp", "SHAJQ", "application")
+	serv := httptest.NewServer(portal)
+	return NewClient(serv.URL, testToken), portal, serv.Close
+}
+
+func TestClientList(t *testing.T) {
+	client, _, closer := newTestClient()
+	defer closer()
+	ctx := context.Background()
+
+	apps, err := client.ListApps(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, apps, 1)
+	assert.Equal(t, "SampleApp", apps[0].AppID)
+
+	apps, err = client.ListApps(ctx, "NotExist")
+	assert.Nil(t, err)
+	assert.Len(t, apps, 0)
+
+	envClusters, err := client.ListEnvClusters(ctx, "SampleApp")
+	assert.Nil(t, err)
+	assert.Equal(t, []*EnvClusters{
+		{Env: "DEV", Clusters: []string{"default"}},
+		{Env: "PRO", Clusters: []string{"SHAJQ"}},
+	}, envClusters)
+
+	namespaces, err := client.ListNamespaces(ctx, "DEV", "SampleApp", "default")
+	assert.Nil(t, err)
+	assert.Len(t, namespaces, 2)
+	assert.Equal(t, "application", namespaces[0].NamespaceName)
+}
+
+func TestClientItemsAndReleases(t *testing.T) {
+	client, portal, closer := newTestClient()
+	defer closer()
+	ctx := context.Background()
+	ref := NamespaceRef{Env: "DEV", AppID: "SampleApp", Cluster: "default", Namespace: "application"}
+
+	item, err := client.CreateItem(ctx, ref, &Item{Key: "timeout", Value: "100", DataChangeCreatedBy: "apollo"})
+	assert.Nil(t, err)
+	assert.Equal(t, "100", item.Value)
+
+	_, err = client.CreateItem(ctx, ref, &Item{Key: "timeout", Value: "100", DataChangeCreatedBy: "apollo"})
+	assert.True(t, IsBadRequest(err), "%v", err)
+
+	first, err := client.PublishRelease(ctx, ref, &NewRelease{Title: "first", Comment: "init", ReleasedBy: "apollo"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"timeout": "100"}, first.Configurations)
+
+	assert.Nil(t, client.UpdateItem(ctx, ref, &Item{Key: "timeout", Value: "200", DataChangeLastModifiedBy: "apollo"}, false))
+	err = client.UpdateItem(ctx, ref, &Item{Key: "retry", Value: "3", DataChangeLastModifiedBy: "apollo"}, false)
+	assert.True(t, IsNotFound(err), "%v", err)
+	assert.Nil(t, client.UpdateItem(ctx, ref, &Item{Key: "retry", Value: "3", DataChangeCreatedBy: "apollo", DataChangeLastModifiedBy: "apollo"}, true))
+	assert.Nil(t, client.DeleteItem(ctx, ref, "retry", "apollo"))
+
+	namespace, err := client.GetNamespace(ctx, ref)
+	assert.Nil(t, err)
+	assert.Len(t, namespace.Items, 1)
+	assert.Equal(t, "200", namespace.Items[0].Value)
+
+	second, err := client.PublishRelease(ctx, ref, &NewRelease{Title: "second", ReleasedBy: "apollo"})
+	assert.Nil(t, err)
+	latest, err := client.GetLatestRelease(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, second.ID, latest.ID)
+	released := portal.Released("DEV", "SampleApp", "default", "application")
+	assert.Equal(t, map[string]string{"timeout": "200"}, released)
+	// the release can't be modified through the returned map
+	released["timeout"] = "300"
+	assert.Equal(t, "200", portal.Released("DEV", "SampleApp", "default", "application")["timeout"])
+
+	assert.Nil(t, client.Rollback(ctx, "DEV", second.ID, "apollo"))
+	latest, err = client.GetLatestRelease(ctx, ref)
+	assert.Nil(t, err)
+	assert.Equal(t, first.ID, latest.ID)
+
+	histories, err := client.ReleaseHistory(ctx, ref, 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, histories, 3)
+	assert.Equal(t, OperationRollback, histories[0].Operation)
+	assert.Equal(t, first.ID, histories[0].ReleaseID)
+	assert.Equal(t, second.ID, histories[0].PreviousReleaseID)
+	assert.Equal(t, OperationNormalRelease, histories[2].Operation)
+
+	histories, err = client.ReleaseHistory(ctx, ref, 1, 2)
+	assert.Nil(t, err)
+	assert.Len(t, histories, 1)
+}
+
+func TestClientErrors(t *testing.T) {
+	client, _, closer := newTestClient()
+	defer closer()
+	ctx := context.Background()
+
+	_, err := client.GetNamespace(ctx, NamespaceRef{Env: "DEV", AppID: "SampleApp"})
+	assert.Equal(t, ErrInvalidRef, err)
+
+	_, err = client.GetNamespace(ctx, NamespaceRef{Env: "DEV", AppID: "SampleApp", Cluster: "default", Namespace: "null"})
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, "openapi: 404 namespace not found", err.Error())
+
+	bad := NewClient(client.addr, "bad token")
+	_, err = bad.ListApps(ctx)
+	assert.True(t, IsUnauthorized(err))
+	assert.False(t, IsForbidden(err))
+}
@@ -0,0 +1,49 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrInvalidRef returned when NamespaceRef misses env, app id, cluster or namespace
+var ErrInvalidRef = errors.New("openapi: env, app id, cluster and namespace are required")
+
+// Error is returned when portal responds a non 2xx status
+type Error struct {
+	StatusCode int    `json:"status"`
+	Exception  string `json:"exception,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("openapi: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("openapi: %d %s", e.StatusCode, e.Message)
+}
+
+// IsBadRequest report whether err is a 400 Error, like invalid params or item exists
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsUnauthorized report whether err is a 401 Error, the token is invalid
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden report whether err is a 403 Error, the token has no permission
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound report whether err is a 404 Error
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+func hasStatus(err error, status int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == status
+}
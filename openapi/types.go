@@ -0,0 +1,96 @@
+package openapi
+
+// App is an Apollo app
+type App struct {
+	Name                       string `json:"name"`
+	AppID                      string `json:"appId"`
+	OrgID                      string `json:"orgId,omitempty"`
+	OrgName                    string `json:"orgName,omitempty"`
+	OwnerName                  string `json:"ownerName,omitempty"`
+	OwnerEmail                 string `json:"ownerEmail,omitempty"`
+	DataChangeCreatedBy        string `json:"dataChangeCreatedBy,omitempty"`
+	DataChangeLastModifiedBy   string `json:"dataChangeLastModifiedBy,omitempty"`
+	DataChangeCreatedTime      string `json:"dataChangeCreatedTime,omitempty"`
+	DataChangeLastModifiedTime string `json:"dataChangeLastModifiedTime,omitempty"`
+}
+
+// EnvClusters are clusters of an app in env
+type EnvClusters struct {
+	Env      string   `json:"env"`
+	Clusters []string `json:"clusters"`
+}
+
+// Namespace is a namespace with its items
+type Namespace struct {
+	AppID                      string  `json:"appId"`
+	ClusterName                string  `json:"clusterName"`
+	NamespaceName              string  `json:"namespaceName"`
+	Comment                    string  `json:"comment,omitempty"`
+	Format                     string  `json:"format,omitempty"`
+	IsPublic                   bool    `json:"isPublic"`
+	Items                      []*Item `json:"items,omitempty"`
+	DataChangeCreatedBy        string  `json:"dataChangeCreatedBy,omitempty"`
+	DataChangeLastModifiedBy   string  `json:"dataChangeLastModifiedBy,omitempty"`
+	DataChangeCreatedTime      string  `json:"dataChangeCreatedTime,omitempty"`
+	DataChangeLastModifiedTime string  `json:"dataChangeLastModifiedTime,omitempty"`
+}
+
+// Item is a key value pair in namespace
+type Item struct {
+	Key                        string `json:"key"`
+	Value                      string `json:"value"`
+	Comment                    string `json:"comment,omitempty"`
+	DataChangeCreatedBy        string `json:"dataChangeCreatedBy,omitempty"`
+	DataChangeLastModifiedBy   string `json:"dataChangeLastModifiedBy,omitempty"`
+	DataChangeCreatedTime      string `json:"dataChangeCreatedTime,omitempty"`
+	DataChangeLastModifiedTime string `json:"dataChangeLastModifiedTime,omitempty"`
+}
+
+// NewRelease describe a release to publish
+type NewRelease struct {
+	Title              string `json:"releaseTitle"`
+	Comment            string `json:"releaseComment,omitempty"`
+	ReleasedBy         string `json:"releasedBy"`
+	IsEmergencyPublish bool   `json:"isEmergencyPublish,omitempty"`
+}
+
+// Release is a published snapshot of namespace
+type Release struct {
+	ID                         int64             `json:"id"`
+	AppID                      string            `json:"appId"`
+	ClusterName                string            `json:"clusterName"`
+	NamespaceName              string            `json:"namespaceName"`
+	Name                       string            `json:"name"`
+	Configurations             map[string]string `json:"configurations"`
+	Comment                    string            `json:"comment,omitempty"`
+	DataChangeCreatedBy        string            `json:"dataChangeCreatedBy,omitempty"`
+	DataChangeLastModifiedBy   string            `json:"dataChangeLastModifiedBy,omitempty"`
+	DataChangeCreatedTime      string            `json:"dataChangeCreatedTime,omitempty"`
+	DataChangeLastModifiedTime string            `json:"dataChangeLastModifiedTime,omitempty"`
+}
+
+// ReleaseOperation is operation recorded in release history
+type ReleaseOperation int
+
+const (
+	OperationNormalRelease ReleaseOperation = 0
+	OperationRollback      ReleaseOperation = 1
+)
+
+// ReleaseHistory is a record of publishing or rolling back
+type ReleaseHistory struct {
+	ID                    int64            `json:"id"`
+	ReleaseID             int64            `json:"releaseId"`
+	PreviousReleaseID     int64            `json:"previousReleaseId"`
+	Operation             ReleaseOperation `json:"operation"`
+	Operator              string           `json:"dataChangeCreatedBy,omitempty"`
+	DataChangeCreatedTime string           `json:"dataChangeCreatedTime,omitempty"`
+}
+
+// NamespaceRef locate a namespace
+type NamespaceRef struct {
+	Env       string
+	AppID     string
+	Cluster   string
+	Namespace string
+}
@@ -2,9 +2,8 @@ package apollo
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
@@ -13,28 +12,53 @@ var _ poller = (*longPoller)(nil)
 
 // poller fetch confi updates
 type poller interface {
-	// start poll updates
+	// start poll updates in background, a stopped poller can be started again
 	start()
 	// preload fetch all config to local cache, and update all notifications
 	preload() error
-	// stop poll updates
-	stop()
+	// stop poll updates, and wait for background polling to exit
+	stop(ctx context.Context) error
 	// addNamespaces add new namespace and pump config data
 	addNamespaces(namespaces ...string) error
+	// registerNamespace add namespace to poll without pumping it, report whether
+	// it's newly added. The in-flight long poll is interrupted to include it.
+	registerNamespace(namespace string) bool
+	// unregisterNamespace undo registerNamespace without waiting for the in-flight
+	// pump, results of it are dropped as the namespace is not subscribed
+	unregisterNamespace(namespace string)
+	// removeNamespaces stop polling namespaces, return namespaces actually removed.
+	// No handler of removed namespaces is running or will run after it returns.
+	removeNamespaces(namespaces ...string) []string
+	// hasNamespace report whether namespace is subscribed, updates of namespaces
+	// not subscribed must not be applied
+	hasNamespace(namespace string) bool
 }
 
-// notificationHandler handle namespace update notification
-type notificationHandler func(namespace string) error
+// notificationHandler handle namespace update notification, ctx is canceled when poller stops
+type notificationHandler func(ctx context.Context, notification *notification) error
 
 // longPoller implement poller interface
 type longPoller struct {
 	conf *Conf
 
 	pollerInterval time.Duration
-	ctx            context.Context
-	cancel         context.CancelFunc
-	version        uint64
-	requester      requester
+	clock          clock
+	// kick wake up watchUpdates to poll at once
+	kick chan struct{}
+
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// pumpLock serialize pumpUpdates, pollCancel interrupt the in-flight long poll
+	pumpLock   sync.Mutex
+	pollLock   sync.Mutex
+	pollCancel context.CancelFunc
+	// waiting is count of lockPump callers waiting for pumpLock, polls started
+	// meanwhile are canceled at once
+	waiting   int
+	requester requester
 
 	notifications *notificationRepo
 	handler       notificationHandler
@@ -45,7 +69,9 @@ func newLongPoller(conf *Conf, interval time.Duration, handler notificationHandl
 	poller := &longPoller{
 		conf:           conf,
 		pollerInterval: interval,
-		requester:      newHTTPRequester(&http.Client{Timeout: longPollTimeout}),
+		clock:          realClock{},
+		kick:           make(chan struct{}, 1),
+		requester:      newHTTPRequester(&http.Client{Timeout: longPollTimeout}, conf.maxResponseBytes()),
 		notifications:  new(notificationRepo),
 		handler:        handler,
 	}
@@ -60,11 +86,31 @@ func newLongPoller(conf *Conf, interval time.Duration, handler notificationHandl
 }
 
 func (p *longPoller) start() {
-	go p.watchUpdates()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	done := make(chan struct{})
+	p.done = done
+	go func(ctx context.Context) {
+		defer close(done)
+		p.watchUpdates(ctx)
+	}(p.ctx)
 }
 
+// preload pull all namespaces. Notification ids of the last run are reset, so
+// a restart isn't held by the server like a long poll without updates, and
+// namespaces not modified meanwhile are answered 304 by release key.
 func (p *longPoller) preload() error {
-	return p.pumpUpdates()
+	p.notifications.resetNotificationIDs(defaultNotificationID)
+	return p.pumpUpdates(p.context())
+}
+
+// context of current run, which is canceled on stop
+func (p *longPoller) context() context.Context {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.ctx
 }
 
 // addNamespaces subscribe to new namespaces and pull all config data to local
@@ -76,72 +122,224 @@ func (p *longPoller) addNamespaces(namespaces ...string) error {
 		}
 	}
 	if update {
-		p.pumpUpdates()
+		// long poll of old namespaces may hold for long, interrupt it so new
+		// namespaces are pumped at once
+		p.lockPump()
+		defer p.pumpLock.Unlock()
+		p.pump(p.context())
 	}
 	return nil
 }
 
-func (p *longPoller) watchUpdates() {
-	timer := time.NewTimer(p.pollerInterval)
+func (p *longPoller) registerNamespace(namespace string) bool {
+	if !p.notifications.addNotificationID(namespace, defaultNotificationID) {
+		return false
+	}
+	p.interrupt()
+	return true
+}
+
+func (p *longPoller) unregisterNamespace(namespace string) {
+	p.notifications.deleteNotificationID(namespace)
+}
+
+// removeNamespaces unsubscribe namespaces, wait for in-flight pump to finish so
+// handler of removed namespaces won't be called any more
+func (p *longPoller) removeNamespaces(namespaces ...string) []string {
+	p.lockPump()
+	defer p.pumpLock.Unlock()
+
+	var removed []string
+	for _, namespace := range namespaces {
+		if p.notifications.deleteNotificationID(namespace) {
+			removed = append(removed, namespace)
+		}
+	}
+	return removed
+}
+
+// lockPump interrupt the in-flight long poll and lock pumpLock. Polls starting
+// before the lock is got are canceled at once, so they won't hold it for long.
+func (p *longPoller) lockPump() {
+	p.pollLock.Lock()
+	p.waiting++
+	if p.pollCancel != nil {
+		p.pollCancel()
+	}
+	p.pollLock.Unlock()
+
+	p.pumpLock.Lock()
+
+	p.pollLock.Lock()
+	p.waiting--
+	p.pollLock.Unlock()
+}
+
+// interrupt the in-flight long poll
+func (p *longPoller) interrupt() {
+	p.pollLock.Lock()
+	defer p.pollLock.Unlock()
+
+	if p.pollCancel != nil {
+		p.pollCancel()
+	}
+}
+
+func (p *longPoller) watchUpdates(ctx context.Context) {
+	timer := p.clock.NewTimer(p.pollerInterval)
 	defer timer.Stop()
 
 	for {
 		select {
-		case <-timer.C:
-			p.pumpUpdates()
+		case <-timer.C():
+			p.pumpUpdates(ctx)
+			timer.Reset(p.pollerInterval)
+
+		case <-p.kick:
+			// drain a fire racing with the kick, so it doesn't cut the next interval short
+			if !timer.Stop() {
+				select {
+				case <-timer.C():
+				default:
+				}
+			}
+			p.pumpUpdates(ctx)
 			timer.Reset(p.pollerInterval)
 
-		case <-p.ctx.Done():
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (p *longPoller) stop() {
+// trigger a poll at once instead of waiting for the interval, a held long poll
+// is interrupted and polled again. It's a hook for tests.
+func (p *longPoller) trigger() {
+	select {
+	case p.kick <- struct{}{}:
+	default:
+	}
+	p.interrupt()
+}
+
+// stop cancel polling and wait for it to exit, then the poller is ready to start again
+func (p *longPoller) stop(ctx context.Context) error {
+	p.lock.Lock()
 	p.cancel()
+	done := p.done
+	p.done = nil
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.lock.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (p *longPoller) updateNotificationConf(notification *notification) {
-	p.notifications.setNotificationID(notification.NamespaceName, notification.NotificationID)
+	p.notifications.updateNotificationID(notification.NamespaceName, notification.NotificationID)
 }
 
-// pumpUpdates fetch updated namespace, handle updated namespace then update notification id
-func (p *longPoller) pumpUpdates() error {
-	// serialize pumpUpdates request
+func (p *longPoller) hasNamespace(namespace string) bool {
+	_, ok := p.notifications.getNotificationID(namespace)
+	return ok
+}
 
-	version := atomic.AddUint64(&p.version, 1)
+// pumpUpdates fetch updated namespace, handle updated namespaces concurrently
+// then update notification id, errors of namespaces are aggregated in NamespaceErrors
+func (p *longPoller) pumpUpdates(ctx context.Context) error {
+	p.pumpLock.Lock()
+	defer p.pumpLock.Unlock()
 
-	var ret error
+	return p.pump(ctx)
+}
 
-	updates, err := p.poll()
+// pump is pumpUpdates with pumpLock held
+func (p *longPoller) pump(ctx context.Context) error {
+	updates, err := p.interruptiblePoll(ctx)
 	if err != nil {
 		return err
 	}
 
-	if atomic.LoadUint64(&p.version) != version {
-		return nil
+	errs := p.handleUpdates(ctx, updates)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// handleUpdates run handler with at most conf.FetchConcurrency workers, so a slow
+// namespace won't delay others
+func (p *longPoller) handleUpdates(ctx context.Context, updates []*notification) NamespaceErrors {
+	var (
+		lock sync.Mutex
+		errs = NamespaceErrors{}
+		wg   sync.WaitGroup
+	)
+
+	queue := make(chan *notification)
+	workers := p.conf.fetchConcurrency()
+	if workers > len(updates) {
+		workers = len(updates)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for update := range queue {
+				if err := p.handler(ctx, update); err != nil {
+					lock.Lock()
+					errs[update.NamespaceName] = err
+					lock.Unlock()
+					continue
+				}
+				p.updateNotificationConf(update)
+			}
+		}()
 	}
 
 	for _, update := range updates {
-		if err := p.handler(update.NamespaceName); err != nil {
-			ret = err
-			continue
-		}
-		p.updateNotificationConf(update)
+		queue <- update
 	}
-	return ret
+	close(queue)
+	wg.Wait()
+
+	return errs
+}
+
+// interruptiblePoll poll with a context canceled by interrupt
+func (p *longPoller) interruptiblePoll(ctx context.Context) ([]*notification, error) {
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.pollLock.Lock()
+	p.pollCancel = cancel
+	if p.waiting > 0 {
+		cancel()
+	}
+	p.pollLock.Unlock()
+
+	defer func() {
+		p.pollLock.Lock()
+		p.pollCancel = nil
+		p.pollLock.Unlock()
+	}()
+
+	return p.poll(pollCtx)
 }
 
 // poll until a update or timeout
-func (p *longPoller) poll() ([]*notification, error) {
+func (p *longPoller) poll(ctx context.Context) ([]*notification, error) {
 	notifications := p.notifications.toString()
 	url := notificationURL(p.conf, notifications)
-	bts, err := p.requester.request(url)
-	if err != nil || len(bts) == 0 {
-		return nil, err
-	}
 	var ret []*notification
-	if err := json.Unmarshal(bts, &ret); err != nil {
+	if _, err := p.requester.request(ctx, url, &ret); err != nil {
 		return nil, err
 	}
 	return ret, nil
@@ -0,0 +1,121 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requesterFunc adapt a function returning raw json to requester
+type requesterFunc func(ctx context.Context, url string) ([]byte, error)
+
+func (f requesterFunc) request(ctx context.Context, url string, v interface{}) (bool, error) {
+	bts, err := f(ctx, url)
+	if err != nil || len(bts) == 0 {
+		return false, err
+	}
+	return true, json.Unmarshal(bts, v)
+}
+
+func TestLongPollerConcurrentUpdates(t *testing.T) {
+	var namespaces []string
+	var updates []*notification
+	for i := 0; i < 20; i++ {
+		namespace := fmt.Sprintf("ns%d", i)
+		namespaces = append(namespaces, namespace)
+		updates = append(updates, &notification{NamespaceName: namespace, NotificationID: i + 1})
+	}
+	conf := &Conf{AppID: "SampleApp", Cluster: "default", NameSpaceNames: namespaces, FetchConcurrency: 4}
+
+	var (
+		lock    sync.Mutex
+		running int
+		peak    int
+	)
+	errBad := errors.New("bad namespace")
+	handler := func(ctx context.Context, n *notification) error {
+		lock.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		lock.Unlock()
+		defer func() {
+			lock.Lock()
+			running--
+			lock.Unlock()
+		}()
+
+		switch n.NamespaceName {
+		case "ns0":
+			time.Sleep(200 * time.Millisecond)
+		case "ns1":
+			return errBad
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+
+	p := newLongPoller(conf, time.Second, handler).(*longPoller)
+	p.requester = requesterFunc(func(ctx context.Context, url string) ([]byte, error) {
+		return json.Marshal(updates)
+	})
+
+	start := time.Now()
+	err := p.preload()
+	elapsed := time.Since(start)
+
+	assert.Equal(t, NamespaceErrors{"ns1": errBad}, err)
+	assert.Equal(t, "ns1: bad namespace", err.Error())
+	assert.Equal(t, 4, peak)
+	// slow namespace runs alongside others, fast ones share the other 3 workers
+	assert.True(t, elapsed < 300*time.Millisecond, elapsed.String())
+
+	id, _ := p.notifications.getNotificationID("ns0")
+	assert.Equal(t, 1, id)
+	id, _ = p.notifications.getNotificationID("ns1")
+	assert.Equal(t, defaultNotificationID, id)
+}
+
+func TestLongPollerInterruptBeforePoll(t *testing.T) {
+	conf := &Conf{AppID: "SampleApp", Cluster: "default", NameSpaceNames: []string{"application", "client.json"}, IP: "127.0.0.1:1"}
+	p := newLongPoller(conf, time.Second, func(ctx context.Context, n *notification) error { return nil }).(*longPoller)
+	// long poll holds until canceled
+	p.requester = requesterFunc(func(ctx context.Context, url string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	// a pump holds the lock between polls, nothing to interrupt yet
+	p.pumpLock.Lock()
+	removed := make(chan []string)
+	go func() { removed <- p.removeNamespaces("client.json") }()
+	for {
+		p.pollLock.Lock()
+		waiting := p.waiting
+		p.pollLock.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// poll started after the interrupt doesn't hold
+	done := make(chan error)
+	go func() { done <- p.pump(context.Background()) }()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("poll should be canceled while removeNamespaces is waiting")
+	}
+	p.pumpLock.Unlock()
+	assert.Equal(t, []string{"client.json"}, <-removed)
+}
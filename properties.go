@@ -0,0 +1,103 @@
+package apollo
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseProperties parse Java properties: comments start with # or !, key and value
+// are separated by =, : or whitespace, a trailing backslash continues the line
+func parseProperties(r io.Reader) (map[string]string, error) {
+	var (
+		props   = map[string]string{}
+		scanner = bufio.NewScanner(r)
+		logical string
+	)
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical == "" && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		if continued(line) {
+			logical += line[:len(line)-1]
+			continue
+		}
+		logical += line
+
+		key, value := splitProperty(logical)
+		props[unescapeProperty(key)] = unescapeProperty(value)
+		logical = ""
+	}
+	if logical != "" {
+		key, value := splitProperty(logical)
+		props[unescapeProperty(key)] = unescapeProperty(value)
+	}
+	return props, scanner.Err()
+}
+
+// continued report whether line ends with an odd number of backslashes
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty split line at the first unescaped separator
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			value := strings.TrimLeft(line[i:], " \t\f")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = value[1:]
+			}
+			return line[:i], strings.TrimLeft(value, " \t\f")
+		}
+	}
+	return line, ""
+}
+
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err == nil {
+					b.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
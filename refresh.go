@@ -0,0 +1,117 @@
+package apollo
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// refresher periodically reconcile local caches with the config service
+type refresher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startRefresh start periodic refresh in background if enabled
+func (c *Client) startRefresh() {
+	if !c.conf.EnableRefresh {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &refresher{cancel: cancel, done: make(chan struct{})}
+	c.refresher = r
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(c.conf.refreshInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.refresh(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopRefresh stop periodic refresh and wait for it to exit
+func (c *Client) stopRefresh(ctx context.Context) error {
+	r := c.refresher
+	if r == nil {
+		return nil
+	}
+	c.refresher = nil
+
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh check every namespace, errors are logged and the namespace is checked next round
+func (c *Client) refresh(ctx context.Context) {
+	for _, namespace := range c.caches.namespaces() {
+		if err := c.refreshNamespace(ctx, namespace); err != nil {
+			log.Printf("[apollo] err refresh namespace %s: %v", namespace, err)
+		}
+	}
+}
+
+// refreshNamespace compare local cache with the cheap /configfiles endpoint, if they
+// differ a release may be missed, then fetch it from /configs and apply through
+// handleResult. /configfiles may lag behind, so it's never applied directly.
+func (c *Client) refreshNamespace(ctx context.Context, namespace string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var configurations map[string]string
+	cluster := c.GetCluster(namespace)
+	if cluster == "" {
+		cluster = c.conf.Cluster
+	}
+	ok, err := c.requester.request(ctx, configFilesURL(c.conf, cluster, namespace), &configurations)
+	if err != nil || !ok {
+		return err
+	}
+
+	cache, ok := c.caches.getCache(namespace)
+	if ok && equalConfigurations(cache.dump(), configurations) {
+		return nil
+	}
+
+	releaseKey := c.GetReleaseKey(namespace)
+	result, err := c.fetch(ctx, namespace)
+	if err != nil || result == nil {
+		return err
+	}
+
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+
+	// unsubscribed while fetching, or the poller applied a release meanwhile which
+	// may be newer than the fetched one
+	if !c.longPoller.hasNamespace(namespace) || c.GetReleaseKey(namespace) != releaseKey {
+		return nil
+	}
+	c.publish(c.handleResult(result))
+	return nil
+}
+
+func equalConfigurations(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
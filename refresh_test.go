@@ -0,0 +1,82 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := NewClient(&Conf{
+		AppID:             "SampleApp",
+		Cluster:           "default",
+		CacheDir:          dir,
+		NameSpaceNames:    []string{defaultNamespace},
+		EnableRefresh:     true,
+		RefreshIntervalMs: 10,
+	})
+	client.handleResult(&result{
+		NamespaceName:  defaultNamespace,
+		Configurations: map[string]string{"key": "1"},
+		ReleaseKey:     "release-1",
+	})
+
+	var lock sync.Mutex
+	var fetches int
+	configurations := map[string]string{"key": "1"}
+	client.requester = requesterFunc(func(ctx context.Context, url string) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if strings.Contains(url, "/configfiles/json/SampleApp/default/application") {
+			return json.Marshal(configurations)
+		}
+		fetches++
+		return json.Marshal(&result{NamespaceName: defaultNamespace, Configurations: configurations, ReleaseKey: "release-2"})
+	})
+
+	// unchanged namespace is not fetched
+	assert.Nil(t, client.refreshNamespace(context.Background(), defaultNamespace))
+	assert.Equal(t, 0, fetches)
+
+	sub := client.Subscribe()
+	defer sub.Close()
+	client.startRefresh()
+
+	// missed release is applied on next refresh
+	lock.Lock()
+	configurations = map[string]string{"key": "2"}
+	lock.Unlock()
+
+	event := <-sub.Events()
+	assert.Equal(t, SourceRemote, event.Source)
+	assert.Equal(t, "release-1", event.OldReleaseKey)
+	assert.Equal(t, "release-2", event.ReleaseKey)
+	assert.Equal(t, map[string]*Change{"key": makeModifyChange("key", "1", "2")}, event.Changes)
+
+	assert.Nil(t, client.stopRefresh(context.Background()))
+	assert.Nil(t, client.stopRefresh(context.Background()))
+
+	// release applied by poller during the fetch is not overwritten
+	client.requester = requesterFunc(func(ctx context.Context, url string) ([]byte, error) {
+		if strings.Contains(url, "/configfiles/") {
+			return json.Marshal(map[string]string{"key": "3"})
+		}
+		client.syncLock.Lock()
+		client.publish(client.handleResult(&result{NamespaceName: defaultNamespace, Configurations: map[string]string{"key": "4"}, ReleaseKey: "release-4"}))
+		client.syncLock.Unlock()
+		return json.Marshal(&result{NamespaceName: defaultNamespace, Configurations: map[string]string{"key": "3"}, ReleaseKey: "release-3"})
+	})
+	assert.Nil(t, client.refreshNamespace(context.Background(), defaultNamespace))
+	assert.Equal(t, "4", client.GetStringValue("key", ""))
+	assert.Equal(t, "release-4", client.GetReleaseKey(defaultNamespace))
+}
@@ -0,0 +1,79 @@
+package apollo
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNotStarted returned by package level functions before apollo started
+	ErrNotStarted = errors.New("apollo not started")
+	// ErrAlreadyStarted returned when starting a running client
+	ErrAlreadyStarted = errors.New("apollo already started")
+	// ErrClientExists returned when registering a client with a used name
+	ErrClientExists = errors.New("apollo client already registered")
+	// ErrClientNotFound returned when looking up an unregistered client
+	ErrClientNotFound = errors.New("apollo client not found")
+	// ErrCacheFileConflict returned when registering a client shares backup file with another one
+	ErrCacheFileConflict = errors.New("apollo client cache file conflicts with a registered one")
+)
+
+// registry of named clients. Multiple Clients can coexist in a process, each
+// has its own caches, long poller and subscribers, and a backup file named by
+// AppID and Cluster in CacheDir. The registry makes sure no two registered
+// clients share the same backup file.
+var registry = struct {
+	lock    sync.RWMutex
+	clients map[string]*Client
+}{
+	clients: map[string]*Client{},
+}
+
+// Register client with name, so it can be looked up anywhere in the process
+func Register(name string, client *Client) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if _, ok := registry.clients[name]; ok {
+		return ErrClientExists
+	}
+	for _, c := range registry.clients {
+		if c.getDumpFileName() == client.getDumpFileName() {
+			return ErrCacheFileConflict
+		}
+	}
+	registry.clients[name] = client
+	return nil
+}
+
+// Unregister client with name, the client is not stopped
+func Unregister(name string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	delete(registry.clients, name)
+}
+
+// Lookup client registered with name
+func Lookup(name string) (*Client, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	if client, ok := registry.clients[name]; ok {
+		return client, nil
+	}
+	return nil, ErrClientNotFound
+}
+
+// StartNamed create a client with conf, start and register it with name
+func StartNamed(name string, conf *Conf) (*Client, error) {
+	client := NewClient(conf)
+	if err := Register(name, client); err != nil {
+		return nil, err
+	}
+	if err := client.Start(); err != nil {
+		Unregister(name)
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,92 @@
+package apollo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotStarted(t *testing.T) {
+	defaultClient.lock.Lock()
+	started := defaultClient.client
+	defaultClient.client = nil
+	defaultClient.lock.Unlock()
+	defer func() {
+		defaultClient.lock.Lock()
+		defaultClient.client = started
+		defaultClient.lock.Unlock()
+	}()
+
+	assert.Equal(t, ErrNotStarted, Stop(context.Background()))
+	assert.Equal(t, ErrNotStarted, SubscribeToNamespaces("application"))
+	assert.Equal(t, ErrNotStarted, WatchConfig(&testConfig{}))
+	assert.Equal(t, "default", GetStringValue("key", "default"))
+	assert.Equal(t, "{}", GetNameSpaceContent("client.json", "{}"))
+	assert.Nil(t, GetAllKeys("application"))
+	assert.Equal(t, "", GetReleaseKey("application"))
+
+	_, ok := <-WatchUpdate()
+	assert.False(t, ok)
+
+	_, err := Subscribe()
+	assert.Equal(t, ErrNotStarted, err)
+	_, err = NewMergedView("application")
+	assert.Equal(t, ErrNotStarted, err)
+}
+
+func TestStartWithConfRunning(t *testing.T) {
+	defaultClient.lock.Lock()
+	started := defaultClient.client
+	defaultClient.client = nil
+	defaultClient.lock.Unlock()
+	defer func() {
+		defaultClient.lock.Lock()
+		defaultClient.client = started
+		defaultClient.lock.Unlock()
+	}()
+
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &Conf{AppID: "SampleApp", Cluster: "default", NameSpaceNames: []string{"application"}, CacheDir: dir, IP: "localhost:8080"}
+	assert.Nil(t, StartWithConf(conf))
+	client := getDefaultClient()
+	assert.Equal(t, ErrAlreadyStarted, StartWithConf(conf))
+	assert.True(t, client == getDefaultClient())
+
+	// a stopped default client can be replaced
+	assert.Nil(t, Stop(context.Background()))
+	assert.Nil(t, StartWithConf(conf))
+	assert.False(t, client == getDefaultClient())
+	assert.Nil(t, Stop(context.Background()))
+}
+
+func TestRegistry(t *testing.T) {
+	app1 := NewClient(&Conf{AppID: "App1", Cluster: "default", CacheDir: "/tmp/apollo"})
+	app2 := NewClient(&Conf{AppID: "App2", Cluster: "SHAJQ", CacheDir: "/tmp/apollo"})
+	conflict := NewClient(&Conf{AppID: "App1", Cluster: "default", CacheDir: "/tmp/apollo"})
+
+	assert.Nil(t, Register("app1", app1))
+	defer Unregister("app1")
+	assert.Nil(t, Register("app2", app2))
+	defer Unregister("app2")
+	assert.Equal(t, ErrClientExists, Register("app1", app2))
+	assert.Equal(t, ErrCacheFileConflict, Register("conflict", conflict))
+
+	client, err := Lookup("app1")
+	assert.Nil(t, err)
+	assert.True(t, client == app1)
+
+	Unregister("app1")
+	_, err = Lookup("app1")
+	assert.Equal(t, ErrClientNotFound, err)
+
+	_, err = StartNamed("app3", &Conf{AppID: "App3", CacheDir: "./LICENSE"})
+	assert.NotNil(t, err)
+	_, err = Lookup("app3")
+	assert.Equal(t, ErrClientNotFound, err)
+}
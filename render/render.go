@@ -0,0 +1,257 @@
+// Package render render text/template files from Apollo namespaces, and
+// re-render them whenever the namespaces change, like consul-template.
+//
+// Templates are executed with a map of namespace to its key values, so
+// {{ index .application "timeout" }} and the funcs below are both available:
+//
+//	{{ get "application" "timeout" }}           value of key, empty if missing
+//	{{ getOr "application" "timeout" "100" }}   value of key, or the default
+//	{{ range $k, $v := ns "application" }}      all key values of namespace
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+)
+
+const defaultCommandTimeout = time.Second * 30
+
+// ErrNoNamespace returned when a renderer watches no namespace
+var ErrNoNamespace = errors.New("render: no namespace to watch")
+
+// Template describe a template file, where it's rendered to, and what to do after
+// the output changes
+type Template struct {
+	// Source is path of the template file
+	Source string
+	// Destination is path of the output file, it's replaced atomically
+	Destination string
+	// Perm of the output file, default 0644
+	Perm os.FileMode
+
+	// Command is run after output changes, like []string{"nginx", "-s", "reload"}
+	Command []string
+	// CommandTimeout kills command running too long, default 30s
+	CommandTimeout time.Duration
+
+	// Signal is sent to process in PIDFile after output changes
+	Signal os.Signal
+	// PIDFile contains pid of process to signal
+	PIDFile string
+}
+
+// Renderer render templates with namespaces of a client
+type Renderer struct {
+	client     *apollo.Client
+	namespaces []string
+	templates  []*Template
+}
+
+// New create renderer of templates, which are rendered with namespaces of client
+func New(client *apollo.Client, namespaces []string, templates ...*Template) (*Renderer, error) {
+	if len(namespaces) == 0 {
+		return nil, ErrNoNamespace
+	}
+	for _, tmpl := range templates {
+		if _, err := parse(tmpl.Source); err != nil {
+			return nil, err
+		}
+	}
+	return &Renderer{client: client, namespaces: namespaces, templates: templates}, nil
+}
+
+// Run render all templates, then re-render on changes of namespaces until ctx is done.
+// Errors after the first render are logged, and the previous outputs are kept.
+func (r *Renderer) Run(ctx context.Context) error {
+	if err := r.client.SubscribeToNamespaces(r.namespaces...); err != nil {
+		return err
+	}
+
+	sub := r.client.Subscribe()
+	defer sub.Close()
+
+	if err := r.Render(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if !r.watches(event.Namespace) {
+				continue
+			}
+			if err := r.Render(ctx); err != nil {
+				log.Printf("[apollo] err render: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Render all templates once, run command or send signal of templates whose output changed
+func (r *Renderer) Render(ctx context.Context) error {
+	data := r.data()
+
+	var ret error
+	for _, tmpl := range r.templates {
+		changed, err := tmpl.render(data)
+		if err != nil {
+			log.Printf("[apollo] err render %s: %v", tmpl.Destination, err)
+			if ret == nil {
+				ret = err
+			}
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := tmpl.notify(ctx); err != nil {
+			log.Printf("[apollo] err notify %s: %v", tmpl.Destination, err)
+			if ret == nil {
+				ret = err
+			}
+		}
+	}
+	return ret
+}
+
+func (r *Renderer) watches(namespace string) bool {
+	for _, ns := range r.namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// data is key values of every namespace
+func (r *Renderer) data() map[string]map[string]string {
+	data := make(map[string]map[string]string, len(r.namespaces))
+	for _, namespace := range r.namespaces {
+		kv := map[string]string{}
+		for _, key := range r.client.GetAllKeys(namespace) {
+			kv[key] = r.client.GetStringValueWithNameSpace(namespace, key, "")
+		}
+		data[namespace] = kv
+	}
+	return data
+}
+
+func parse(source string) (*template.Template, error) {
+	return template.New(filepath.Base(source)).Funcs(template.FuncMap{
+		// placeholders, replaced by funcs bound to data on execute
+		"get":   func(namespace, key string) string { return "" },
+		"getOr": func(namespace, key, defaultValue string) string { return "" },
+		"ns":    func(namespace string) map[string]string { return nil },
+	}).Option("missingkey=zero").ParseFiles(source)
+}
+
+// render template with data, report whether the output changed
+func (t *Template) render(data map[string]map[string]string) (bool, error) {
+	tmpl, err := parse(t.Source)
+	if err != nil {
+		return false, err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"get": func(namespace, key string) string {
+			return data[namespace][key]
+		},
+		"getOr": func(namespace, key, defaultValue string) string {
+			if value, ok := data[namespace][key]; ok && value != "" {
+				return value
+			}
+			return defaultValue
+		},
+		"ns": func(namespace string) map[string]string {
+			return data[namespace]
+		},
+	})
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return false, err
+	}
+
+	if old, err := ioutil.ReadFile(t.Destination); err == nil && bytes.Equal(old, buf.Bytes()) {
+		return false, nil
+	}
+	perm := t.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	return true, writeFile(t.Destination, buf.Bytes(), perm)
+}
+
+// notify run command and send signal after output changed
+func (t *Template) notify(ctx context.Context) error {
+	if len(t.Command) > 0 {
+		timeout := t.CommandTimeout
+		if timeout <= 0 {
+			timeout = defaultCommandTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		out, err := exec.CommandContext(ctx, t.Command[0], t.Command[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("run %s: %v: %s", t.Command[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	if t.Signal != nil && t.PIDFile != "" {
+		bts, err := ioutil.ReadFile(t.PIDFile)
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(bts)))
+		if err != nil {
+			return err
+		}
+		process, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		return process.Signal(t.Signal)
+	}
+	return nil
+}
+
+// writeFile write data to a temp file in the same dir then rename it to name,
+// so readers never see a half written file
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apollo "github.com/liamylian/apollo-client"
+	"github.com/stretchr/testify/assert"
+)
+
+// server serve namespace application, notify clients when it's set
+type server struct {
+	lock    sync.Mutex
+	id      int
+	configs map[string]string
+}
+
+func (s *server) set(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.id++
+	s.configs[key] = value
+}
+
+func (s *server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if strings.HasPrefix(req.URL.Path, "/notifications/") {
+		if strings.Contains(req.FormValue("notifications"), fmt.Sprintf(`"notificationId":%d}`, s.id)) {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(rw, `[{"namespaceName":"application","notificationId":%d}]`, s.id)
+		return
+	}
+	bts, _ := json.Marshal(map[string]interface{}{
+		"namespaceName":  "application",
+		"configurations": s.configs,
+		"releaseKey":     fmt.Sprint(s.id),
+	})
+	rw.Write(bts)
+}
+
+func TestRenderer(t *testing.T) {
+	srv := &server{configs: map[string]string{"port": "80", "host": "localhost"}}
+	serv := httptest.NewServer(srv)
+	defer serv.Close()
+
+	dir, err := ioutil.TempDir("", "render")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	client := apollo.NewClient(&apollo.Conf{
+		AppID:          "SampleApp",
+		Cluster:        "default",
+		NameSpaceNames: []string{"application"},
+		CacheDir:       dir,
+		MetaAddr:       serv.URL,
+	})
+	assert.Nil(t, client.Start())
+	defer client.Stop(context.Background())
+
+	source := filepath.Join(dir, "nginx.conf.tmpl")
+	assert.Nil(t, ioutil.WriteFile(source, []byte(
+		`listen {{ get "application" "port" }};
+server_name {{ index .application "host" }};
+timeout {{ getOr "application" "timeout" "30s" }};
+{{ range $k, $v := ns "application" }}# {{ $k }}
+{{ end }}`), 0644))
+	destination := filepath.Join(dir, "nginx.conf")
+	marker := filepath.Join(dir, "reloaded")
+
+	renderer, err := New(client, []string{"application"}, &Template{
+		Source:      source,
+		Destination: destination,
+		Perm:        0600,
+		Command:     []string{"sh", "-c", "echo reloaded >> " + marker},
+	})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- renderer.Run(ctx) }()
+
+	waitFile(t, destination, "listen 80;\nserver_name localhost;\ntimeout 30s;\n# host\n# port\n")
+	f, err := os.Stat(destination)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), f.Mode().Perm())
+
+	srv.set("timeout", "60s")
+	waitFile(t, destination, "listen 80;\nserver_name localhost;\ntimeout 60s;\n# host\n# port\n# timeout\n")
+	waitFile(t, marker, "reloaded\nreloaded\n")
+
+	cancel()
+	assert.Nil(t, <-done)
+
+	// unchanged output doesn't run command
+	assert.Nil(t, renderer.Render(context.Background()))
+	waitFile(t, marker, "reloaded\nreloaded\n")
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, nil)
+	assert.Equal(t, ErrNoNamespace, err)
+
+	_, err = New(nil, []string{"application"}, &Template{Source: "not-exist.tmpl"})
+	assert.NotNil(t, err)
+}
+
+func waitFile(t *testing.T, name, content string) {
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		bts, _ := ioutil.ReadFile(name)
+		if got = string(bts); got == content {
+			return
+		}
+	}
+	t.Fatalf("%s should be %q, got %q", name, content, got)
+}
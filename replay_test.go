@@ -0,0 +1,247 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exchange is a scripted response of a request
+type exchange struct {
+	Endpoint  string          `json:"endpoint"`
+	Namespace string          `json:"namespace,omitempty"`
+	Status    int             `json:"status"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+// replayRequester serve scripted exchanges in order. A notification request
+// with nothing scripted is held until canceled, like a long poll without updates.
+type replayRequester struct {
+	lock     sync.Mutex
+	script   []*exchange
+	requests []string
+}
+
+func loadReplay(name string) (*replayRequester, error) {
+	bts, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &replayRequester{}
+	return r, json.Unmarshal(bts, &r.script)
+}
+
+func (r *replayRequester) request(ctx context.Context, target string, v interface{}) (bool, error) {
+	endpoint, namespace := parseEndpoint(target)
+
+	r.lock.Lock()
+	r.requests = append(r.requests, target)
+	var ex *exchange
+	for i, e := range r.script {
+		if e.Endpoint == endpoint && (e.Namespace == "" || e.Namespace == namespace) {
+			ex = e
+			r.script = append(r.script[:i], r.script[i+1:]...)
+			break
+		}
+	}
+	r.lock.Unlock()
+
+	if ex == nil {
+		if endpoint == "notifications" {
+			<-ctx.Done()
+			return false, ctx.Err()
+		}
+		return false, fmt.Errorf("replay: no response scripted for %s", target)
+	}
+
+	switch ex.Status {
+	case http.StatusOK:
+		return true, json.Unmarshal(ex.Body, v)
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusNotFound:
+		return false, ErrorStatusNotFound
+	}
+	return false, ErrorStatusNotOK
+}
+
+// remaining return count of exchanges not served
+func (r *replayRequester) remaining() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.script)
+}
+
+// recordingRequester record exchanges of requester, to be saved as a replay fixture
+type recordingRequester struct {
+	requester requester
+
+	lock      sync.Mutex
+	exchanges []*exchange
+}
+
+func (r *recordingRequester) request(ctx context.Context, target string, v interface{}) (bool, error) {
+	ok, err := r.requester.request(ctx, target, v)
+
+	endpoint, namespace := parseEndpoint(target)
+	ex := &exchange{Endpoint: endpoint, Status: http.StatusOK}
+	if endpoint != "notifications" {
+		ex.Namespace = namespace
+	}
+	switch {
+	case err == ErrorStatusNotFound:
+		ex.Status = http.StatusNotFound
+	case err != nil:
+		// canceled or failed requests are not replayable
+		return ok, err
+	case !ok:
+		ex.Status = http.StatusNotModified
+	default:
+		if ex.Body, err = json.Marshal(v); err != nil {
+			return ok, err
+		}
+	}
+
+	r.lock.Lock()
+	r.exchanges = append(r.exchanges, ex)
+	r.lock.Unlock()
+	return ok, nil
+}
+
+func (r *recordingRequester) save(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	bts, err := json.MarshalIndent(r.exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, bts, 0644)
+}
+
+// parseEndpoint return endpoint and namespace of request url
+func parseEndpoint(target string) (string, string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", ""
+	}
+	strs := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	if strs[0] == "configs" && len(strs) == 4 {
+		return strs[0], strs[3]
+	}
+	return strs[0], ""
+}
+
+// newReplayClient create a client whose polling is driven by requester and clock
+func newReplayClient(dir string, r requester, c clock) *Client {
+	client := NewClient(&Conf{
+		AppID:          "SampleApp",
+		Cluster:        "default",
+		NameSpaceNames: []string{defaultNamespace},
+		CacheDir:       dir,
+		IP:             "localhost:8080",
+	})
+	client.requester = r
+	p := client.longPoller.(*longPoller)
+	p.requester = r
+	p.clock = c
+	return client
+}
+
+func TestClientReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	replay, err := loadReplay("./testdata/replay/release.json")
+	assert.Nil(t, err)
+	clock := newFakeClock()
+	client := newReplayClient(dir, replay, clock)
+
+	assert.Nil(t, client.Start())
+	defer client.Stop(context.Background())
+	assert.Equal(t, "100", client.GetStringValue("timeout", ""))
+	sub := client.Subscribe()
+	defer sub.Close()
+
+	// 304 on the first interval, then release-2 on the next one
+	clock.waitTimer()
+	clock.Advance(longPollInterval)
+	clock.waitTimer()
+	clock.Advance(longPollInterval)
+	event := <-sub.Events()
+	assert.Equal(t, "release-1", event.OldReleaseKey)
+	assert.Equal(t, "release-2", event.ReleaseKey)
+	assert.Equal(t, 2, event.NotificationID)
+	assert.Equal(t, map[string]*Change{
+		"timeout": makeModifyChange("timeout", "100", "200"),
+		"retry":   makeAddChange("retry", "3"),
+	}, event.Changes)
+
+	// notification 3 is not modified, notification 4 delete timeout
+	poller := client.longPoller.(*longPoller)
+	clock.waitTimer()
+	poller.trigger()
+	clock.waitTimer()
+	poller.trigger()
+	event = <-sub.Events()
+	assert.Equal(t, "release-4", event.ReleaseKey)
+	assert.Equal(t, 4, event.NotificationID)
+	assert.Equal(t, map[string]*Change{"timeout": makeDeleteChange("timeout", "200")}, event.Changes)
+	assert.Equal(t, 0, replay.remaining())
+}
+
+func TestClientRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	serv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/notifications/v2" {
+			var notifications []*notification
+			json.Unmarshal([]byte(req.FormValue("notifications")), &notifications)
+			if len(notifications) == 1 && notifications[0].NotificationID == 1 {
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+			json.NewEncoder(rw).Encode([]*notification{{NamespaceName: "record", NotificationID: 1}})
+			return
+		}
+		json.NewEncoder(rw).Encode(&result{NamespaceName: "record", Configurations: map[string]string{"key": "1"}, ReleaseKey: "release-1"})
+	}))
+	defer serv.Close()
+
+	recorder := &recordingRequester{requester: newHTTPRequester(&http.Client{}, 0)}
+	conf := &Conf{AppID: "SampleApp", Cluster: "default", NameSpaceNames: []string{"record"}, CacheDir: dir, MetaAddr: serv.URL}
+	client := NewClient(conf)
+	client.requester = recorder
+	client.longPoller.(*longPoller).requester = recorder
+	assert.Nil(t, client.Start())
+	assert.Nil(t, client.Stop(context.Background()))
+
+	fixture := path.Join(dir, "record.json")
+	assert.Nil(t, recorder.save(fixture))
+
+	replay, err := loadReplay(fixture)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Remove(client.getDumpFileName()))
+	client = NewClient(conf)
+	client.requester = replay
+	client.longPoller.(*longPoller).requester = replay
+	assert.Nil(t, client.Start())
+	defer client.Stop(context.Background())
+	assert.Equal(t, "1", client.GetStringValueWithNameSpace("record", "key", ""))
+	assert.Equal(t, 0, replay.remaining())
+}
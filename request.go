@@ -1,43 +1,141 @@
 package apollo
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 var ErrorStatusNotOK = errors.New("http resp code not ok")
 
+// ErrorStatusNotFound returned when config or namespace not found
+var ErrorStatusNotFound = errors.New("http resp code not found")
+
+// ErrResponseTooLarge returned when decoded response body exceeds Conf.MaxResponseBytes
+var ErrResponseTooLarge = errors.New("http resp body exceeds max response size")
+
 // this is a static check
 var _ requester = (*httprequester)(nil)
 
 type requester interface {
-	request(url string) ([]byte, error)
+	// request url and decode json response into v, ok is false if server
+	// responds 304 Not Modified or an empty body
+	request(ctx context.Context, url string, v interface{}) (ok bool, err error)
 }
 
 type httprequester struct {
-	client *http.Client
+	client  *http.Client
+	maxSize int64
 }
 
-func newHTTPRequester(client *http.Client) requester {
+func newHTTPRequester(client *http.Client, maxSize int64) requester {
 	return &httprequester{
-		client: client,
+		client:  client,
+		maxSize: maxSize,
 	}
 }
 
-func (r *httprequester) request(url string) ([]byte, error) {
-	resp, err := r.client.Get(url)
+func (r *httprequester) request(ctx context.Context, url string, v interface{}) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	// set explicitly, so compressed body is limited after decompression by us
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	resp, err := r.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		return ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		// Diacard all body if status code is not 200
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		switch resp.StatusCode {
+		case http.StatusNotModified:
+			return false, nil
+		case http.StatusNotFound:
+			return false, ErrorStatusNotFound
+		}
+		return false, ErrorStatusNotOK
+	}
+
+	decoded, err := decodeBody(resp)
+	if err != nil {
+		return false, err
+	}
+	defer decoded.Close()
+
+	var body io.Reader = decoded
+	limited := &limitedReader{r: body, n: r.maxSize}
+	if r.maxSize > 0 {
+		body = limited
+	}
+
+	err = json.NewDecoder(body).Decode(v)
+	if limited.exceeded {
+		// decoder may report the truncated body as a syntax error
+		return false, ErrResponseTooLarge
+	}
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// decodeBody decompress body by Content-Encoding, closing the returned reader
+// doesn't close resp.Body
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		// deflate should be zlib wrapped, but some servers send raw deflate
+		br := bufio.NewReader(resp.Body)
+		header, err := br.Peek(2)
+		if err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
 	}
+	return ioutil.NopCloser(resp.Body), nil
+}
 
-	// Diacard all body if status code is not 200
-	_, _ = io.Copy(ioutil.Discard, resp.Body)
-	return nil, ErrorStatusNotOK
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// limitedReader read at most n bytes, then fail with ErrResponseTooLarge
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// read one more byte to tell body of exactly n bytes from a larger one
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		// never hand out bytes beyond the limit
+		n = int(l.n)
+		l.n = 0
+		l.exceeded = true
+		return n, ErrResponseTooLarge
+	}
+	l.n -= int64(n)
+	return n, err
 }
@@ -2,36 +2,51 @@ package apollo
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
 func TestRequest(t *testing.T) {
-	request := newHTTPRequester(&http.Client{})
+	request := newHTTPRequester(&http.Client{}, 0)
 
 	serv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		rw.Write([]byte("test"))
+		rw.Write([]byte(`"test"`))
 	}))
 
-	bts, err := request.request(serv.URL)
+	var str string
+	ok, err := request.request(context.Background(), serv.URL, &str)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if !bytes.Equal(bts, []byte("test")) {
+	if !ok || str != "test" {
 		t.FailNow()
 	}
 
 	serv = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(http.StatusInternalServerError)
 	}))
-	bts, err = request.request(serv.URL)
-	if err != nil && err != ErrorStatusNotOK {
+	ok, err = request.request(context.Background(), serv.URL, &str)
+	if err != ErrorStatusNotOK {
 		t.Error(err)
 	}
 
-	if len(bts) != 0 {
+	if ok {
+		t.FailNow()
+	}
+
+	serv = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNotModified)
+	}))
+	ok, err = request.request(context.Background(), serv.URL, &str)
+	if ok || err != nil {
 		t.FailNow()
 	}
 
@@ -39,8 +54,53 @@ func TestRequest(t *testing.T) {
 		rw.WriteHeader(http.StatusInternalServerError)
 	}))
 	serv.Close()
-	_, err = request.request(serv.URL)
+	_, err = request.request(context.Background(), serv.URL, &str)
 	if err == nil {
 		t.FailNow()
 	}
 }
+
+func TestRequestCompressed(t *testing.T) {
+	body := `{"namespaceName":"application","configurations":{"key":"value"}}`
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+
+	for name, encoder := range encoders {
+		serv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var buf bytes.Buffer
+			w := encoder(&buf)
+			w.Write([]byte(body))
+			w.Close()
+
+			if name == "raw" {
+				rw.Header().Set("Content-Encoding", "deflate")
+			} else {
+				rw.Header().Set("Content-Encoding", name)
+			}
+			rw.Write(buf.Bytes())
+		}))
+
+		var ret result
+		ok, err := newHTTPRequester(&http.Client{}, int64(len(body))).request(context.Background(), serv.URL, &ret)
+		if err != nil || !ok || ret.Configurations["key"] != "value" {
+			t.Fatal(name, err)
+		}
+
+		// limit applies to decompressed body
+		_, err = newHTTPRequester(&http.Client{}, int64(len(body)-1)).request(context.Background(), serv.URL, &ret)
+		if err != ErrResponseTooLarge {
+			t.Fatal(name, err)
+		}
+		serv.Close()
+	}
+}
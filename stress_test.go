@@ -0,0 +1,104 @@
+package apollo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liamylian/apollo-client/internal/mockserver"
+)
+
+// TestClientStress hammer subscribe, stop, start and get in parallel, run with -race
+func TestClientStress(t *testing.T) {
+	conf, err := NewConf("./testdata/app.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.AppID = "StressApp"
+	client := NewClient(conf)
+	defer os.Remove(client.getDumpFileName())
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubscribeToNamespaces("stress"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				f(i)
+			}
+		}()
+	}
+
+	for n := 0; n < 4; n++ {
+		run(func(i int) {
+			sub := client.Subscribe(WithSnapshot(), WithBuffer(i%4+1))
+			timeout, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+			drain(sub.Events(), timeout.Done())
+			cancel()
+			sub.Close()
+		})
+		run(func(i int) {
+			client.GetStringValueWithNameSpace("stress", "key", "")
+			client.GetAllKeys("stress")
+			client.GetReleaseKey("stress")
+		})
+	}
+	run(func(i int) {
+		drain(client.WatchUpdate(), ctx.Done())
+	})
+	run(func(i int) {
+		mockserver.Set("stress", "key", fmt.Sprint(i))
+		time.Sleep(time.Millisecond)
+	})
+	run(func(i int) {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+		defer stopCancel()
+		if err := client.Stop(stopCtx); err != nil && err != ErrNotStarted {
+			t.Errorf("Stop should return nil, got: %v", err)
+		}
+		if err := client.Start(); err != nil && err != ErrAlreadyStarted {
+			t.Errorf("Start should return nil, got: %v", err)
+		}
+		time.Sleep(time.Millisecond * 20)
+	})
+	run(func(i int) {
+		client.SubscribeToNamespaces(fmt.Sprintf("stress-%d", i%3))
+		time.Sleep(time.Millisecond * 5)
+	})
+
+	wg.Wait()
+
+	// Stop waits for subscribers to receive pending events
+	go drain(client.WatchUpdate(), nil)
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+	defer stopCancel()
+	if err := client.Stop(stopCtx); err != nil {
+		t.Errorf("Stop should return nil, got: %v", err)
+	}
+}
+
+// drain events until closed or done
+func drain(events <-chan *ChangeEvent, done <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
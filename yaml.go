@@ -0,0 +1,290 @@
+package apollo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of YAML without indent and comment
+type yamlLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+// parseYAML parse the YAML subset conf files need, which is a single document of:
+//
+//   - block mappings, nested by indent
+//   - block sequences of scalars
+//   - flow sequences of scalars like [a, b]
+//   - single line plain, single quoted and double quoted scalars
+//   - # comments
+//
+// Flow mappings, block scalars (| and >), multi-line plain scalars, sequences of
+// mappings or sequences, anchors, aliases, tags, complex keys and multiple
+// documents are rejected with an error naming the construct. Plain scalars are
+// typed like YAML does, so the result can be re-encoded as JSON.
+func parseYAML(bts []byte) (map[string]interface{}, error) {
+	var lines []yamlLine
+	for i, text := range strings.Split(string(bts), "\n") {
+		text = strings.TrimRight(stripYAMLComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." {
+			if len(lines) > 0 {
+				return nil, fmt.Errorf("conf: yaml line %d: multiple documents are not supported", i+1)
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("conf: yaml line %d: tab indent", i+1)
+		}
+		lines = append(lines, yamlLine{no: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	v, next, err := parseYAMLBlock(lines, 0)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("conf: yaml line %d: unexpected indent", lines[next].no)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("conf: yaml is not a mapping")
+	}
+	return m, nil
+}
+
+// parseYAMLBlock parse the block starting at lines[i], return its value and index
+// of the line after it
+func parseYAMLBlock(lines []yamlLine, i int) (interface{}, int, error) {
+	indent := lines[i].indent
+	if isYAMLItem(lines[i].text) {
+		var seq []interface{}
+		for ; i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].text); i++ {
+			item := strings.TrimSpace(lines[i].text[1:])
+			if item == "" || isYAMLItem(item) {
+				return nil, 0, fmt.Errorf("conf: yaml line %d: sequence of sequences is not supported", lines[i].no)
+			}
+			if _, _, ok := splitYAMLKey(item); ok && !strings.HasPrefix(item, "[") {
+				return nil, 0, fmt.Errorf("conf: yaml line %d: sequence of mappings is not supported", lines[i].no)
+			}
+			v, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, 0, fmt.Errorf("conf: yaml line %d: %v", lines[i].no, err)
+			}
+			seq = append(seq, v)
+		}
+		if i < len(lines) && lines[i].indent > indent {
+			return nil, 0, fmt.Errorf("conf: yaml line %d: multi-line plain scalar is not supported", lines[i].no)
+		}
+		return seq, i, nil
+	}
+
+	m := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent {
+		line := lines[i]
+		if strings.HasPrefix(line.text, "? ") || line.text == "?" {
+			return nil, 0, fmt.Errorf("conf: yaml line %d: complex key is not supported", line.no)
+		}
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, 0, fmt.Errorf("conf: yaml line %d: expect key: value", line.no)
+		}
+		if key == "<<" {
+			return nil, 0, fmt.Errorf("conf: yaml line %d: merge key is not supported", line.no)
+		}
+		i++
+
+		if value != "" {
+			v, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, 0, fmt.Errorf("conf: yaml line %d: %v", line.no, err)
+			}
+			if i < len(lines) && lines[i].indent > indent {
+				return nil, 0, fmt.Errorf("conf: yaml line %d: multi-line plain scalar is not supported", lines[i].no)
+			}
+			m[key] = v
+			continue
+		}
+
+		// nested block is indented, or a sequence at the same indent
+		if i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLItem(lines[i].text)) {
+			v, next, err := parseYAMLBlock(lines, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], i = v, next
+			continue
+		}
+		m[key] = nil
+	}
+	return m, i, nil
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey split `key: value`, key may be quoted
+func splitYAMLKey(text string) (string, string, bool) {
+	var key string
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, text = text[1:end+1], text[end+2:]
+		if !strings.HasPrefix(text, ":") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[1:]), true
+	}
+
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		i = len(text) - 1
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+}
+
+// parseYAMLScalar parse a scalar or flow sequence
+func parseYAMLScalar(s string) (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] == '[' {
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unclosed flow sequence")
+		}
+		items, err := splitYAMLFlow(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		seq := []interface{}{}
+		for _, item := range items {
+			if strings.HasPrefix(item, "[") {
+				return nil, fmt.Errorf("nested flow sequence is not supported")
+			}
+			v, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	}
+	if construct, ok := unsupportedYAML[s[0]]; ok {
+		return nil, fmt.Errorf("%s is not supported", construct)
+	}
+	switch s[0] {
+	case '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double quoted scalar %s", s)
+		}
+		return v, nil
+	case '\'':
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unclosed quote")
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// unsupportedYAML name constructs by their indicator at start of a value
+var unsupportedYAML = map[byte]string{
+	'{': "flow mapping",
+	'|': "block scalar |",
+	'>': "block scalar >",
+	'&': "anchor",
+	'*': "alias",
+	'!': "tag",
+	'@': "reserved indicator @",
+	'`': "reserved indicator `",
+}
+
+// splitYAMLFlow split items of flow sequence by comma outside of quotes
+func splitYAMLFlow(s string) ([]string, error) {
+	var (
+		items []string
+		quote byte
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			return nil, fmt.Errorf("flow mapping is not supported")
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote")
+	}
+	items = append(items, s[start:])
+
+	var ret []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
+
+// stripYAMLComment remove # comment which starts a line or follows a space,
+// outside of quoted scalars
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[,", text[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}